@@ -0,0 +1,103 @@
+package gomek
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned by the bind functions when the request body is
+// larger than `Config.MaxBodyBytes`
+var ErrBodyTooLarge = errors.New("gomek: request body too large")
+
+// ErrInvalidBody is wrapped by the errors returned by the bind functions when the
+// request body can't be decoded
+var ErrInvalidBody = errors.New("gomek: invalid request body")
+
+// isBodyTooLarge reports whether err was returned by a body limited with
+// http.MaxBytesReader. http.MaxBytesError is Go 1.19+ so the message is matched.
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// readBody reads the whole request body. Views limit it to `Config.MaxBodyBytes`
+// with http.MaxBytesReader.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		return nil, ErrBodyTooLarge
+	}
+	return body, err
+}
+
+// BindOptions configures how `BindJSON` & `Bind` decode a request body
+type BindOptions struct {
+	// DisallowUnknownFields rejects bodies with fields dst doesn't have
+	DisallowUnknownFields bool
+}
+
+// BindOption changes a single BindOptions value
+type BindOption func(o *BindOptions)
+
+// BindDisallowUnknownFields rejects bodies with fields dst doesn't have, e.g. a
+// client setting "admin": true
+//
+//	user, err := gomek.Bind[NewUser](r, gomek.BindDisallowUnknownFields())
+func BindDisallowUnknownFields() BindOption {
+	return func(o *BindOptions) {
+		o.DisallowUnknownFields = true
+	}
+}
+
+// BindJSON decodes the JSON request body into dst, which must be a pointer to a
+// struct, then validates it, see `Validate`. Trailing data is rejected, unknown
+// fields are ignored unless `BindDisallowUnknownFields` is passed. A
+// `*ValidationError` is returned if the body is valid JSON but fails validation.
+//
+//	type NewUser struct {
+//		Name  string `json:"name" validate:"required,min=3"`
+//		Email string `json:"email" validate:"required,email"`
+//	}
+//
+//	var user NewUser
+//	if err := gomek.BindJSON(r, &user); err != nil {
+//		gomek.JSON(w, err, http.StatusUnprocessableEntity)
+//		return
+//	}
+func BindJSON(r *http.Request, dst interface{}, opts ...BindOption) error {
+	var o BindOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if o.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBody, err)
+	}
+	// More is false at a stray } or ], decoding again must reach the end
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidBody)
+	}
+	return Validate(dst)
+}
+
+// Bind is the generic version of `BindJSON`
+//
+//	user, err := gomek.Bind[NewUser](r)
+func Bind[T any](r *http.Request, opts ...BindOption) (T, error) {
+	var dst T
+	err := BindJSON(r, &dst, opts...)
+	return dst, err
+}
@@ -0,0 +1,119 @@
+package gomek
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testSignup struct {
+	Name  string `json:"name" validate:"required,min=3"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+func TestBindJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Joe","email":"joe@example.com"}`))
+	var signup testSignup
+	if err := BindJSON(req, &signup); err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	if signup.Name != "Joe" || signup.Email != "joe@example.com" {
+		t.Errorf("Expected Joe & joe@example.com got %v", signup)
+	}
+}
+
+func TestBindJSONUnknownField(t *testing.T) {
+	body := `{"name":"Joe","email":"joe@example.com","admin":true}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	var signup testSignup
+	if err := BindJSON(req, &signup); err != nil {
+		t.Errorf("Expected unknown fields to be ignored got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	err := BindJSON(req, &signup, BindDisallowUnknownFields())
+	var verr *ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Errorf("Expected an unknown field error got %v", err)
+	}
+}
+
+func TestBindZeroValue(t *testing.T) {
+	type adult struct {
+		Age int `json:"age" validate:"min=18"`
+	}
+	for _, body := range []string{`{"age":0}`, `{}`} {
+		req := httptest.NewRequest(http.MethodPost, "/adults", strings.NewReader(body))
+		_, err := Bind[adult](req)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Fields()["age"] != "must be at least 18" {
+			t.Errorf("%s: Expected age must be at least 18 got %v", body, err)
+		}
+	}
+}
+
+func TestBindJSONTrailingData(t *testing.T) {
+	for _, body := range []string{` {}`, `}`, `]`, `x`} {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Joe","email":"joe@example.com"}`+body))
+		var signup testSignup
+		if err := BindJSON(req, &signup); !errors.Is(err, ErrInvalidBody) {
+			t.Errorf("%s: Expected an error for trailing data got %v", body, err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Joe","email":"joe@example.com"}`+"\n"))
+	var signup testSignup
+	if err := BindJSON(req, &signup); err != nil {
+		t.Errorf("Expected trailing whitespace to be allowed got %v", err)
+	}
+}
+
+func TestBindJSONTooLarge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Joe"}`))
+	w := httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(w, req.Body, 4)
+	var signup testSignup
+	if err := BindJSON(req, &signup); err != ErrBodyTooLarge {
+		t.Errorf("Expected %v got %v", ErrBodyTooLarge, err)
+	}
+}
+
+func TestBindJSONMaxBodyBytes(t *testing.T) {
+	body := `{"name":"Joe","email":"joe@example.com","bio":"` + strings.Repeat("a", DEFAULT_MAX_BODY_BYTES) + `"}`
+	for _, maxBodyBytes := range []int64{50 << 20, -1} {
+		var err error
+		app := New(Config{MaxBodyBytes: maxBodyBytes})
+		app.Route("/users").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+			var signup testSignup
+			err = BindJSON(r, &signup)
+		}).Methods("POST")
+		app.setup().Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+		if err != nil {
+			t.Errorf("MaxBodyBytes %d: expected nil got %v", maxBodyBytes, err)
+		}
+	}
+
+	var err error
+	app := New(Config{MaxBodyBytes: 16})
+	app.Route("/users").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		var signup testSignup
+		err = BindJSON(r, &signup)
+	}).Methods("POST")
+	app.setup().Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+	if err != ErrBodyTooLarge {
+		t.Errorf("Expected %v got %v", ErrBodyTooLarge, err)
+	}
+}
+
+func TestBind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Jo","email":"joe@example.com"}`))
+	_, err := Bind[testSignup](req)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError got %v", err)
+	}
+	if message := verr.Fields()["name"]; message != "must be at least 3 characters" {
+		t.Errorf("Expected must be at least 3 characters got '%s'", message)
+	}
+}
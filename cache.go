@@ -0,0 +1,381 @@
+package gomek
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Entries held by the in-memory cache before the least recently used is evicted
+	DEFAULT_CACHE_SIZE = 1000
+	// Response header reporting whether a response came from the cache
+	CACHE_STATUS_HEADER = "X-Cache"
+)
+
+// CachedResponse is a response stored by `App.Cache`
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Tags    []string
+	Created time.Time
+}
+
+// CacheStore stores cached responses. Implement it to share a cache between
+// instances, e.g. with Redis. Set `Config.CacheStore` to use it.
+type CacheStore interface {
+	// Get returns the entry for key if it hasn't expired
+	Get(key string) (*CachedResponse, bool)
+	// Set stores res for ttl
+	Set(key string, res *CachedResponse, ttl time.Duration)
+	// Delete removes the entry for key
+	Delete(key string)
+	// Purge removes every entry tagged with tag
+	Purge(tag string)
+}
+
+type memoryCacheEntry struct {
+	key     string
+	res     *CachedResponse
+	expires time.Time
+}
+
+// MemoryCache is an in-memory LRU `CacheStore`
+type MemoryCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	tags    map[string]map[string]struct{}
+}
+
+// NewMemoryCache creates a MemoryCache that holds up to size entries
+//
+//	app := gomek.New(gomek.Config{CacheStore: gomek.NewMemoryCache(10000)})
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = DEFAULT_CACHE_SIZE
+	}
+	return &MemoryCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		tags:    map[string]map[string]struct{}{},
+	}
+}
+
+func (m *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		m.remove(el)
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+	return entry.res, true
+}
+
+func (m *MemoryCache) Set(key string, res *CachedResponse, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	el := m.lru.PushFront(&memoryCacheEntry{key: key, res: res, expires: time.Now().Add(ttl)})
+	m.entries[key] = el
+	for _, tag := range res.Tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = map[string]struct{}{}
+		}
+		m.tags[tag][key] = struct{}{}
+	}
+	for m.lru.Len() > m.size {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+}
+
+func (m *MemoryCache) Purge(tag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.tags[tag] {
+		if el, ok := m.entries[key]; ok {
+			m.remove(el)
+		}
+	}
+	delete(m.tags, tag)
+}
+
+// Len returns the number of entries, including expired entries not yet removed
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// remove deletes el from the list, index & tags. m.mu must be held.
+func (m *MemoryCache) remove(el *list.Element) {
+	entry := m.lru.Remove(el).(*memoryCacheEntry)
+	delete(m.entries, entry.key)
+	for _, tag := range entry.res.Tags {
+		delete(m.tags[tag], entry.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
+
+// flightGroup runs a single call per key, concurrent callers share its result
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg       sync.WaitGroup
+	res      *CachedResponse
+	panicked bool
+	rec      interface{}
+}
+
+// do calls fn for key unless a call is in flight. shared is true for callers
+// that waited for another caller's result. If fn panics the waiters panic
+// with the same value.
+func (g *flightGroup) do(key string, fn func() *CachedResponse) (res *CachedResponse, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		if c.panicked {
+			panic(c.rec)
+		}
+		return c.res, true
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+	completed := false
+	defer func() {
+		if !completed {
+			c.panicked = true
+			c.rec = recover()
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+		if c.panicked {
+			panic(c.rec)
+		}
+	}()
+	c.res = fn()
+	completed = true
+	return c.res, false
+}
+
+// Cache caches the current route's GET responses for ttl. Responses are keyed by
+// their path, query & the values of the varyBy request headers. Concurrent misses
+// for the same key render the response once. Requests with `Cache-Control: no-cache`
+// refresh the entry. Only 200 responses without cookies or `Cache-Control:
+// private/no-store` are stored. The cache is always the route's innermost
+// middleware, wherever it's chained, so hits still pass through the route's
+// `IPFilter`, `RateLimit` & other middleware.
+//
+//	app.Route("/reports").View(reports).Methods("GET").Templates("./templates/reports.gohtml").Cache(time.Minute, "Accept-Language")
+func (a *App) Cache(ttl time.Duration, varyBy ...string) *App {
+	a.currentCache = a.cacheMiddleware(ttl, varyBy)
+	return a
+}
+
+// CacheTags tags the response being cached so it can be removed with `App.PurgeCache`
+//
+//	gomek.CacheTags(r, "notices", "notice:"+id)
+func CacheTags(r *http.Request, tags ...string) {
+	if holder, ok := r.Context().Value(cacheTagsKey).(*[]string); ok {
+		*holder = append(*holder, tags...)
+	}
+}
+
+// PurgeCache removes every cached response tagged with one of tags
+//
+//	app.PurgeCache("notices")
+func (a *App) PurgeCache(tags ...string) {
+	store := a.cacheStore()
+	for _, tag := range tags {
+		store.Purge(tag)
+	}
+}
+
+func (a *App) cacheStore() CacheStore {
+	a.cacheOnce.Do(func() {
+		if a.Config.CacheStore == nil {
+			a.Config.CacheStore = NewMemoryCache(DEFAULT_CACHE_SIZE)
+		}
+	})
+	return a.Config.CacheStore
+}
+
+// cacheKey builds a key from the path, sorted query & varyBy headers
+func cacheKey(r *http.Request, varyBy []string) string {
+	var b strings.Builder
+	b.WriteString(r.URL.Path)
+	query := r.URL.Query()
+	if len(query) > 0 {
+		// Encode sorts by key
+		b.WriteString("?" + query.Encode())
+	}
+	for _, name := range varyBy {
+		b.WriteString("\n" + strings.ToLower(name) + ":" + url.QueryEscape(r.Header.Get(name)))
+	}
+	return b.String()
+}
+
+// cacheable reports whether a rendered response may be shared between clients
+func cacheable(res *CachedResponse) bool {
+	if res.Status != http.StatusOK || res.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(res.Header.Get("Cache-Control"))
+	return !strings.Contains(cc, "private") && !strings.Contains(cc, "no-store")
+}
+
+func (a *App) cacheMiddleware(ttl time.Duration, varyBy []string) func(next http.Handler) http.HandlerFunc {
+	group := &flightGroup{}
+	sort.Strings(varyBy)
+	vary := strings.Join(varyBy, ", ")
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if vary != "" {
+				w.Header().Add("Vary", vary)
+			}
+			cc := strings.ToLower(r.Header.Get("Cache-Control"))
+			if strings.Contains(cc, "no-store") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			store := a.cacheStore()
+			key := cacheKey(r, varyBy)
+			refresh := strings.Contains(cc, "no-cache") || r.Header.Get("Pragma") == "no-cache"
+			if !refresh {
+				if res, ok := store.Get(key); ok {
+					writeCachedResponse(w, res, "HIT")
+					return
+				}
+			}
+			// A HEAD request's empty body mustn't be stored for GET requests
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			render := func() *CachedResponse {
+				var tags []string
+				ctx := context.WithValue(r.Context(), cacheTagsKey, &tags)
+				cw := &cacheWriter{header: http.Header{}}
+				next.ServeHTTP(cw, r.WithContext(ctx))
+				if cw.status == 0 {
+					cw.status = http.StatusOK
+				}
+				// A page rendered with a CSP nonce is stored with the policy allowing that
+				// nonce, so hits don't get the policy of a newer request
+				if nonce := CSPNonce(r); nonce != "" && cw.header.Get("Content-Security-Policy") == "" {
+					if csp := w.Header().Get("Content-Security-Policy"); strings.Contains(csp, nonce) {
+						cw.header.Set("Content-Security-Policy", csp)
+					}
+				}
+				res := &CachedResponse{
+					Status:  cw.status,
+					Header:  cw.header,
+					Body:    cw.body,
+					Tags:    tags,
+					Created: time.Now(),
+				}
+				if cacheable(res) {
+					store.Set(key, res, ttl)
+				}
+				return res
+			}
+			res, shared := group.do(key, render)
+			if shared && (res == nil || !cacheable(res)) {
+				// The response can't be shared so render it for this client
+				res = render()
+			}
+			writeCachedResponse(w, res, "MISS")
+		})
+	}
+}
+
+func writeCachedResponse(w http.ResponseWriter, res *CachedResponse, status string) {
+	header := w.Header()
+	for k, v := range res.Header {
+		// The trace ID belongs to the request that was cached
+		if k == TRACE_ID_HEADER {
+			continue
+		}
+		if k == "Vary" {
+			for _, value := range v {
+				header.Add(k, value)
+			}
+			continue
+		}
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(CACHE_STATUS_HEADER, status)
+	if status == "HIT" {
+		header.Set("Age", strconv.Itoa(int(time.Since(res.Created).Seconds())))
+	}
+	w.WriteHeader(res.Status)
+	w.Write(res.Body)
+}
+
+// cacheWriter records a response. It doesn't implement `http.Flusher` as
+// streamed responses can't be cached.
+type cacheWriter struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (c *cacheWriter) Header() http.Header {
+	return c.header
+}
+
+func (c *cacheWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body = append(c.body, b...)
+	return len(b), nil
+}
@@ -0,0 +1,212 @@
+package gomek
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func cacheRequest(handler http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCacheRoute(t *testing.T) {
+	var renders int32
+	app := New(Config{})
+	app.Route("/reports").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		n := atomic.AddInt32(&renders, 1)
+		CacheTags(r, "reports")
+		JSON(w, map[string]interface{}{"render": n, "lang": r.Header.Get("Accept-Language")}, http.StatusOK)
+	}).Methods("GET").Cache(time.Minute, "Accept-Language")
+	handler := app.setup().Handler
+
+	first := cacheRequest(handler, "/reports?b=2&a=1", nil)
+	if first.Header().Get(CACHE_STATUS_HEADER) != "MISS" || first.Header().Get("Vary") != "Accept-Language" {
+		t.Fatalf("Expected a miss got %v", first.Header())
+	}
+	// The query order doesn't matter
+	second := cacheRequest(handler, "/reports?a=1&b=2", nil)
+	if second.Header().Get(CACHE_STATUS_HEADER) != "HIT" || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected a hit got %v %s", second.Header(), second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != "application/json" || second.Header().Get("Age") == "" {
+		t.Errorf("Expected the cached headers got %v", second.Header())
+	}
+	if w := cacheRequest(handler, "/reports?a=1&b=2", http.Header{"Accept-Language": {"fr"}}); w.Header().Get(CACHE_STATUS_HEADER) != "MISS" {
+		t.Errorf("Expected a different header value to miss")
+	}
+	if w := cacheRequest(handler, "/reports?a=1&b=2", http.Header{"Cache-Control": {"no-cache"}}); w.Header().Get(CACHE_STATUS_HEADER) != "MISS" {
+		t.Errorf("Expected no-cache to refresh the entry")
+	}
+	if renders != 3 {
+		t.Errorf("Expected 3 renders got %d", renders)
+	}
+	app.PurgeCache("reports")
+	if w := cacheRequest(handler, "/reports?a=1&b=2", nil); w.Header().Get(CACHE_STATUS_HEADER) != "MISS" {
+		t.Errorf("Expected a miss after purging")
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	var renders int32
+	release := make(chan struct{})
+	app := New(Config{})
+	app.Route("/slow").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		atomic.AddInt32(&renders, 1)
+		<-release
+		w.Write([]byte("slow"))
+	}).Methods("GET").Cache(time.Minute)
+	handler := app.setup().Handler
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := cacheRequest(handler, "/slow", nil); w.Body.String() != "slow" {
+				t.Errorf("Expected slow got %s", w.Body.String())
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if renders != 1 {
+		t.Errorf("Expected concurrent misses to render once got %d", renders)
+	}
+}
+
+func TestCacheSingleflightPanic(t *testing.T) {
+	release := make(chan struct{})
+	app := New(Config{})
+	app.Route("/broken").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		<-release
+		panic("render failed")
+	}).Methods("GET").Cache(time.Minute)
+	handler := app.setup().Handler
+
+	var wg sync.WaitGroup
+	recovered := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				recovered <- recover()
+			}()
+			cacheRequest(handler, "/broken", nil)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(recovered)
+	for rec := range recovered {
+		if rec != "render failed" {
+			t.Errorf("Expected the view's panic got %v", rec)
+		}
+	}
+}
+
+func TestCacheTemplates(t *testing.T) {
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "layout.gohtml")
+	os.WriteFile(layout, []byte(`{{ define "layout" }}{{ template "content" . }}{{ end }}`), 0600)
+	reports := filepath.Join(dir, "reports.gohtml")
+	os.WriteFile(reports, []byte(`{{ define "content" }}{{ .lang }}{{ end }}`), 0600)
+	reportsView := func(w http.ResponseWriter, r *http.Request, d *Data) {
+		*d = Data{"lang": r.Header.Get("Accept-Language")}
+	}
+
+	app := New(Config{BaseTemplates: []string{layout}})
+	app.Route("/reports").View(reportsView).Methods("GET").Templates(reports).Cache(time.Minute, "Accept-Language")
+	handler := app.setup().Handler
+
+	header := http.Header{"Accept-Language": {"fr"}}
+	for _, status := range []string{"MISS", "HIT"} {
+		w := cacheRequest(handler, "/reports", header)
+		if w.Header().Get(CACHE_STATUS_HEADER) != status || w.Body.String() != "fr" {
+			t.Errorf("Expected a %s rendering fr got %v %s", status, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestCacheUncacheable(t *testing.T) {
+	tests := map[string]func(w http.ResponseWriter){
+		"cookie": func(w http.ResponseWriter) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			w.Write([]byte("ok"))
+		},
+		"private": func(w http.ResponseWriter) {
+			w.Header().Set("Cache-Control", "private")
+			w.Write([]byte("ok"))
+		},
+		"error": func(w http.ResponseWriter) {
+			http.Error(w, "failed", http.StatusInternalServerError)
+		},
+	}
+	for name, view := range tests {
+		view := view
+		app := New(Config{})
+		app.Route("/page").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+			view(w)
+		}).Methods("GET").Cache(time.Minute)
+		handler := app.setup().Handler
+		cacheRequest(handler, "/page", nil)
+		if w := cacheRequest(handler, "/page", nil); w.Header().Get(CACHE_STATUS_HEADER) != "MISS" {
+			t.Errorf("%s: expected the response not to be cached", name)
+		}
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	for i := 0; i < 3; i++ {
+		cache.Set(fmt.Sprint(i), &CachedResponse{Tags: []string{"even" + fmt.Sprint(i%2)}}, time.Minute)
+		if i == 1 {
+			// Keep 0 recently used so 1 is evicted
+			cache.Get("0")
+		}
+	}
+	if _, ok := cache.Get("1"); ok || cache.Len() != 2 {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	cache.Purge("even0")
+	if _, ok := cache.Get("0"); ok {
+		t.Errorf("Expected the tagged entry to be purged")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected an empty cache got %d", cache.Len())
+	}
+	cache.Set("expired", &CachedResponse{}, -time.Second)
+	if _, ok := cache.Get("expired"); ok {
+		t.Errorf("Expected expired entries to be missed")
+	}
+}
+
+func TestCacheInnermost(t *testing.T) {
+	app := New(Config{})
+	app.Route("/reports").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		w.Write([]byte("report"))
+	}).Methods("GET").Cache(time.Minute).RateLimit(RateLimitOptions{Limit: 2, Window: time.Minute})
+	handler := app.setup().Handler
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := cacheRequest(handler, "/reports", nil)
+		if w.Code != expected {
+			t.Errorf("%d: expected %d got %d %v", i, expected, w.Code, w.Header())
+		}
+	}
+}
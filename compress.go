@@ -0,0 +1,339 @@
+package gomek
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Responses smaller than this aren't worth compressing
+	DEFAULT_COMPRESS_MIN_SIZE = 1024
+)
+
+// DEFAULT_COMPRESS_TYPES are the content types compressed by default. Entries
+// ending in "/" match every subtype.
+var DEFAULT_COMPRESS_TYPES = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// DEFAULT_COMPRESS_ENCODINGS is the server's order of preference when a client
+// accepts several encodings equally. "br" is only used once registered.
+var DEFAULT_COMPRESS_ENCODINGS = []string{"br", "gzip", "deflate"}
+
+// CompressWriter is a compressing writer that can be reused, e.g. `*gzip.Writer`
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressors creates the writers for each content coding
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]func(w io.Writer, level int) (CompressWriter, error){
+		"gzip": func(w io.Writer, level int) (CompressWriter, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (CompressWriter, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+)
+
+// RegisterCompressor adds a content coding to `Compress`. Use it to add brotli
+// from a third party package
+//
+//	gomek.RegisterCompressor("br", func(w io.Writer, level int) (gomek.CompressWriter, error) {
+//		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+//	})
+func RegisterCompressor(encoding string, newWriter func(w io.Writer, level int) (CompressWriter, error)) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[encoding] = newWriter
+}
+
+// CompressOptions configures `Compress`. Zero values use the defaults.
+type CompressOptions struct {
+	// Level passed to the compressor, defaults to `gzip.DefaultCompression`
+	Level int
+	// MinSize in bytes of a response before it is compressed. Defaults to
+	// `DEFAULT_COMPRESS_MIN_SIZE`, a negative value compresses every response.
+	// Flushed responses are always compressed.
+	MinSize int
+	// ContentTypes to compress, defaults to `DEFAULT_COMPRESS_TYPES`
+	ContentTypes []string
+	// Encodings in order of preference, defaults to `DEFAULT_COMPRESS_ENCODINGS`
+	Encodings []string
+}
+
+// parseAcceptEncoding returns the q value of each coding in an Accept-Encoding header
+func parseAcceptEncoding(header string) map[string]float64 {
+	codings := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		q := 1.0
+		params = strings.ReplaceAll(params, " ", "")
+		if strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = v
+			}
+		}
+		codings[token] = q
+	}
+	return codings
+}
+
+// negotiateEncoding picks the client's most preferred coding out of encodings
+func negotiateEncoding(header string, encodings []string) string {
+	codings := parseAcceptEncoding(header)
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := codings[encoding]
+		if !ok {
+			q, ok = codings["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// Compress compresses responses with the best encoding the client accepts.
+// Small responses, responses that are already encoded & content types that
+// don't compress well, such as images, are sent as is. Flushed responses, e.g.
+// `SSE`, are compressed & flushed as they are written.
+//
+//	app.Use(gomek.Compress(gomek.CompressOptions{}))
+func Compress(opts CompressOptions) func(next http.Handler) http.HandlerFunc {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DEFAULT_COMPRESS_MIN_SIZE
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = DEFAULT_COMPRESS_TYPES
+	}
+	if opts.Encodings == nil {
+		opts.Encodings = DEFAULT_COMPRESS_ENCODINGS
+	}
+	pools := map[string]*sync.Pool{}
+	var poolsMu sync.Mutex
+	pool := func(encoding string) *sync.Pool {
+		poolsMu.Lock()
+		defer poolsMu.Unlock()
+		if p, ok := pools[encoding]; ok {
+			return p
+		}
+		compressorsMu.RLock()
+		newWriter := compressors[encoding]
+		compressorsMu.RUnlock()
+		p := &sync.Pool{New: func() interface{} {
+			cw, err := newWriter(io.Discard, opts.Level)
+			if err != nil {
+				// An invalid level, fall back to the default
+				cw, _ = newWriter(io.Discard, gzip.DefaultCompression)
+			}
+			return cw
+		}}
+		pools[encoding] = p
+		return p
+	}
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var available []string
+			compressorsMu.RLock()
+			for _, encoding := range opts.Encodings {
+				if _, ok := compressors[encoding]; ok {
+					available = append(available, encoding)
+				}
+			}
+			compressorsMu.RUnlock()
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), available)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				pool:           pool(encoding),
+				opts:           &opts,
+			}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// response should be compressed
+type compressWriter struct {
+	http.ResponseWriter
+	encoding   string
+	pool       *sync.Pool
+	opts       *CompressOptions
+	status     int
+	buf        []byte
+	decided    bool
+	hijacked   bool
+	compressor CompressWriter
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+	// Informational responses are sent straight away
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if len(c.buf) < c.opts.MinSize {
+			return len(b), nil
+		}
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.compressor != nil {
+		return c.compressor.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *compressWriter) compressible() bool {
+	header := c.ResponseWriter.Header()
+	if c.status < 200 || c.status == http.StatusNoContent || c.status == http.StatusNotModified || c.status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(c.buf)
+		header.Set("Content-Type", contentType)
+	}
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range c.opts.ContentTypes {
+		if contentType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the headers & buffered body, compressing them if large enough
+func (c *compressWriter) decide(largeEnough bool) error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if largeEnough && c.compressible() {
+		header := c.ResponseWriter.Header()
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		// The strong ETag belongs to the uncompressed body
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		c.compressor = c.pool.Get().(CompressWriter)
+		c.compressor.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.compressor != nil {
+		_, err := c.compressor.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush compresses what has been written so far & sends it to the client
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if err := c.decide(true); err != nil {
+			return
+		}
+	}
+	if c.compressor != nil {
+		c.compressor.Flush()
+	}
+	flush(c.ResponseWriter)
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := hijack(c.ResponseWriter)
+	if err == nil {
+		c.hijacked = true
+	}
+	return conn, brw, err
+}
+
+// Close writes any buffered response & returns the compressor to its pool
+func (c *compressWriter) Close() error {
+	if c.hijacked {
+		return nil
+	}
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			// Nothing was written, let the server send its default response
+			return nil
+		}
+		if err := c.decide(false); err != nil {
+			return err
+		}
+	}
+	if c.compressor == nil {
+		return nil
+	}
+	err := c.compressor.Close()
+	c.compressor.Reset(io.Discard)
+	c.pool.Put(c.compressor)
+	c.compressor = nil
+	return err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
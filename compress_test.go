@@ -0,0 +1,155 @@
+package gomek
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var compressBody = strings.Repeat("gomek ", 500)
+
+func newCompressHandler(opts CompressOptions, contentType string, body string) http.Handler {
+	return Compress(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Length", "3000")
+		w.Write([]byte(body))
+	}))
+}
+
+func compressRequest(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompress(t *testing.T) {
+	handler := newCompressHandler(CompressOptions{}, "text/plain; charset=utf-8", compressBody)
+	w := compressRequest(handler, "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzip response got %v", w.Header())
+	}
+	if w.Header().Get("Content-Length") != "" {
+		t.Errorf("Expected Content-Length to be removed")
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if body, _ := io.ReadAll(gz); string(body) != compressBody {
+		t.Errorf("Expected the original body after decompressing")
+	}
+
+	w = compressRequest(handler, "gzip;q=0.5, deflate")
+	if w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected a deflate response got %v", w.Header())
+	}
+	if body, _ := io.ReadAll(flate.NewReader(w.Body)); string(body) != compressBody {
+		t.Errorf("Expected the original body after decompressing")
+	}
+	// The same pooled writers are reused
+	for i := 0; i < 3; i++ {
+		w = compressRequest(handler, "gzip")
+		gz, _ := gzip.NewReader(w.Body)
+		if body, _ := io.ReadAll(gz); string(body) != compressBody {
+			t.Errorf("Expected the original body from a pooled writer")
+		}
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		acceptEncoding string
+	}{
+		{"not accepted", newCompressHandler(CompressOptions{}, "text/plain", compressBody), ""},
+		{"identity", newCompressHandler(CompressOptions{}, "text/plain", compressBody), "gzip;q=0, identity"},
+		{"too small", newCompressHandler(CompressOptions{}, "text/plain", "small"), "gzip"},
+		{"image", newCompressHandler(CompressOptions{}, "image/png", compressBody), "gzip"},
+		{"custom types", newCompressHandler(CompressOptions{ContentTypes: []string{"application/json"}}, "text/html", compressBody), "gzip"},
+		{"already encoded", Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte(compressBody))
+		})), "gzip"},
+	}
+	for _, tt := range tests {
+		w := compressRequest(tt.handler, tt.acceptEncoding)
+		if w.Header().Get("Content-Encoding") == "gzip" {
+			t.Errorf("%s: expected an uncompressed response got %v", tt.name, w.Header())
+		}
+		if body := w.Body.String(); body != compressBody && body != "small" {
+			t.Errorf("%s: expected the original body got %q", tt.name, body)
+		}
+	}
+}
+
+func TestCompressSniffedType(t *testing.T) {
+	handler := newCompressHandler(CompressOptions{MinSize: -1}, "", "<html><body>hi</body></html>")
+	w := compressRequest(handler, "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected a sniffed & compressed html response got %v", w.Header())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	app := New(Config{})
+	app.Use(Compress(CompressOptions{}))
+	app.Use(Logging)
+	sent := make(chan struct{})
+	app.Route("/events").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		stream, err := SSE(w, r)
+		if err != nil {
+			t.Errorf("Expected nil got %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Send("notice", "1", "hello")
+		<-sent
+	}).Methods("GET")
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+	defer close(sent)
+
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip stream got %v", res.Header)
+	}
+	// The first event arrives before the response has finished
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if event := readEvent(t, bufio.NewReader(gz)); event != "event: notice\nid: 1\ndata: hello\n" {
+		t.Errorf("Unexpected event %q", event)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"gzip, deflate, br":   "gzip",
+		"deflate, gzip;q=0.9": "deflate",
+		"*":                   "gzip",
+		"*, gzip;q=0":         "deflate",
+		"identity":            "",
+	}
+	for header, expected := range tests {
+		if got := negotiateEncoding(header, DEFAULT_COMPRESS_ENCODINGS[1:]); got != expected {
+			t.Errorf("%q: expected %q got %q", header, expected, got)
+		}
+	}
+}
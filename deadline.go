@@ -0,0 +1,19 @@
+//go:build go1.20
+
+package gomek
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// withConn is the server's ConnContext, the connection is reached through
+// `http.ResponseController` instead
+var withConn func(ctx context.Context, c net.Conn) context.Context
+
+// clearWriteDeadline lets a streaming response outlive `Config.WriteTimeout`
+func clearWriteDeadline(w http.ResponseWriter, r *http.Request) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,25 @@
+//go:build !go1.20
+
+package gomek
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// withConn is the server's ConnContext, it stores the connection so its write
+// deadline can be cleared
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, c)
+}
+
+// clearWriteDeadline lets a streaming response outlive `Config.WriteTimeout`.
+// Before Go 1.20 only HTTP/1 connections can be reached, HTTP/2 streams keep
+// their deadline.
+func clearWriteDeadline(w http.ResponseWriter, r *http.Request) {
+	if conn, ok := r.Context().Value(connKey).(net.Conn); ok && r.ProtoMajor == 1 {
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
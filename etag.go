@@ -0,0 +1,232 @@
+package gomek
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagOptions configures `ConditionalGET`
+type ETagOptions struct {
+	// Weak generates weak ETags, e.g. W/"3f2a9c1b", for responses whose bytes
+	// may change without their meaning changing
+	Weak bool
+	// RequireIfMatch rejects PUT, PATCH & DELETE requests without an If-Match
+	// header with a 428 Precondition Required
+	RequireIfMatch bool
+}
+
+// ETag adds the `ConditionalGET` middleware to the current route
+//
+//	app.Route("/notices").View(notices).Methods("GET").ETag()
+func (a *App) ETag(opts ...ETagOptions) *App {
+	var o ETagOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	a.currentMiddleware = append(a.currentMiddleware, ConditionalGET(o))
+	return a
+}
+
+// ConditionalGET buffers GET & HEAD responses to generate their ETag, then
+// answers `If-None-Match` & `If-Modified-Since` requests with a 304 Not Modified.
+// ETags & Last-Modified headers set by the view are used as they are. Flushed
+// responses are streamed without an ETag.
+//
+//	app.Use(gomek.ConditionalGET(gomek.ETagOptions{Weak: true}))
+func ConditionalGET(opts ETagOptions) func(next http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				if opts.RequireIfMatch && r.Header.Get("If-Match") == "" {
+					httpError(w, r, http.StatusPreconditionRequired, "this request requires an If-Match header")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+			if ew.passthrough {
+				return
+			}
+			if ew.status == 0 {
+				ew.status = http.StatusOK
+			}
+			header := w.Header()
+			if ew.status == http.StatusOK && header.Get("ETag") == "" {
+				header.Set("ETag", generateETag(ew.buf, opts.Weak))
+			}
+			if ew.status == http.StatusOK && notModified(r, header.Get("ETag"), header.Get("Last-Modified")) {
+				writeNotModified(w)
+				return
+			}
+			w.WriteHeader(ew.status)
+			w.Write(ew.buf)
+		})
+	}
+}
+
+// generateETag hashes body into a quoted ETag
+func generateETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:])[:16] + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// etagMatches compares etag against an If-Match or If-None-Match header. The
+// weak comparison ignores the W/ prefix, the strong comparison never matches
+// weak ETags.
+func etagMatches(header string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !weak && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when it's absent
+func notModified(r *http.Request, etag string, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag, true)
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified == "" {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	return err == nil && !modified.Truncate(time.Second).After(ims)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// Conditional sets the resource's ETag & Last-Modified headers, then checks the
+// request's preconditions. GET & HEAD requests that match are answered with a
+// 304, PUT, PATCH & DELETE requests whose If-Match doesn't match the current ETag
+// get a 412 Precondition Failed. Returns false once the response has been written.
+// Pass an empty etag or zero time to skip either.
+//
+//	func (n *Notice) Put(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		notice := notices.Get(gomek.Args(r)["id"])
+//		if !gomek.Conditional(w, r, notice.Version, notice.UpdatedAt) {
+//			return
+//		}
+//		// safe to update
+//	}
+func Conditional(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" && !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	header := w.Header()
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if notModified(r, etag, header.Get("Last-Modified")) {
+			writeNotModified(w)
+			return false
+		}
+	case http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodPost:
+		if im := r.Header.Get("If-Match"); im != "" && !etagMatches(im, etag, false) {
+			httpError(w, r, http.StatusPreconditionFailed, "the resource has been modified")
+			return false
+		}
+		ius, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+		if err == nil && r.Header.Get("If-Match") == "" && !lastModified.IsZero() && lastModified.Truncate(time.Second).After(ius) {
+			httpError(w, r, http.StatusPreconditionFailed, "the resource has been modified")
+			return false
+		}
+	}
+	return true
+}
+
+// etagWriter buffers a response until it has been generated
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         []byte
+	passthrough bool
+}
+
+func (e *etagWriter) WriteHeader(status int) {
+	if e.passthrough {
+		e.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if e.status == 0 {
+		e.status = status
+	}
+}
+
+func (e *etagWriter) Write(b []byte) (int, error) {
+	if e.passthrough {
+		return e.ResponseWriter.Write(b)
+	}
+	if e.status == 0 {
+		e.status = http.StatusOK
+	}
+	e.buf = append(e.buf, b...)
+	return len(b), nil
+}
+
+// Flush stops buffering & streams the rest of the response without an ETag
+func (e *etagWriter) Flush() {
+	if !e.passthrough {
+		e.passthrough = true
+		if e.status == 0 {
+			e.status = http.StatusOK
+		}
+		e.ResponseWriter.WriteHeader(e.status)
+		e.ResponseWriter.Write(e.buf)
+		e.buf = nil
+	}
+	flush(e.ResponseWriter)
+}
+
+func (e *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := hijack(e.ResponseWriter)
+	if err == nil {
+		e.passthrough = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (e *etagWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
@@ -0,0 +1,121 @@
+package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func conditionalRequest(handler http.Handler, method string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/notices", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestETagRoute(t *testing.T) {
+	app := New(Config{})
+	app.Route("/notices").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		w.Header().Set("Last-Modified", "Tue, 02 Jan 2024 03:04:05 GMT")
+		JSON(w, []string{"notice"}, http.StatusOK)
+	}).Methods("GET", "HEAD").ETag()
+	handler := app.setup().Handler
+
+	w := conditionalRequest(handler, "GET", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "[\"notice\"]\n" || len(etag) != 18 {
+		t.Fatalf("Expected a 200 with a strong ETag got %d %s %v", w.Code, w.Body.String(), w.Header())
+	}
+	if head := conditionalRequest(handler, "HEAD", nil); head.Header().Get("ETag") != etag {
+		t.Errorf("Expected HEAD to have the same ETag got %s", head.Header().Get("ETag"))
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"matching etag", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified},
+		{"weak comparison", http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified},
+		{"any", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"changed", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {"Tue, 02 Jan 2024 03:04:05 GMT"}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {"Mon, 01 Jan 2024 00:00:00 GMT"}}, http.StatusOK},
+		// If-None-Match takes precedence
+		{"etag over date", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {"Tue, 02 Jan 2024 03:04:05 GMT"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := conditionalRequest(handler, "GET", tt.header)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.status, w.Code)
+		}
+		if tt.status == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != etag || w.Header().Get("Content-Type") != "") {
+			t.Errorf("%s: expected an empty 304 with the ETag got %v", tt.name, w.Header())
+		}
+	}
+}
+
+func TestConditionalGETWeak(t *testing.T) {
+	handler := ConditionalGET(ETagOptions{Weak: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("notice"))
+	}))
+	w := conditionalRequest(handler, "GET", nil)
+	etag := w.Header().Get("ETag")
+	if etag[:2] != "W/" {
+		t.Fatalf("Expected a weak ETag got %s", etag)
+	}
+	if w := conditionalRequest(handler, "GET", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 got %d", w.Code)
+	}
+	// Errors aren't given ETags
+	handler = ConditionalGET(ETagOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	}))
+	if w := conditionalRequest(handler, "GET", http.Header{"If-None-Match": {"*"}}); w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Errorf("Expected a 404 without an ETag got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestConditional(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := ConditionalGET(ETagOptions{RequireIfMatch: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Conditional(w, r, "v2", updated) {
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		status int
+	}{
+		{"get", "GET", nil, http.StatusOK},
+		{"get not modified", "GET", http.Header{"If-None-Match": {`"v2"`}}, http.StatusNotModified},
+		{"put matching", "PUT", http.Header{"If-Match": {`"v2"`}}, http.StatusOK},
+		{"put stale", "PUT", http.Header{"If-Match": {`"v1"`}}, http.StatusPreconditionFailed},
+		{"put weak", "PUT", http.Header{"If-Match": {`W/"v2"`}}, http.StatusPreconditionFailed},
+		{"delete any", "DELETE", http.Header{"If-Match": {"*"}}, http.StatusOK},
+		{"delete without if-match", "DELETE", nil, http.StatusPreconditionRequired},
+		{"put unmodified since", "PUT", http.Header{"If-Match": {`"v2"`}, "If-Unmodified-Since": {"Mon, 01 Jan 2024 00:00:00 GMT"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := conditionalRequest(handler, tt.method, tt.header)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d got %d %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+		if w.Header().Get("ETag") != `"v2"` && tt.status != http.StatusPreconditionRequired {
+			t.Errorf("%s: expected the view's ETag got %s", tt.name, w.Header().Get("ETag"))
+		}
+	}
+	// If-Unmodified-Since is used without If-Match
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/notices", nil)
+	req.Header.Set("If-Unmodified-Since", "Mon, 01 Jan 2024 00:00:00 GMT")
+	if Conditional(w, req, "v2", updated) || w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 got %d", w.Code)
+	}
+}
@@ -0,0 +1,246 @@
+package gomek
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	// Memory used to parse multipart forms, larger parts are stored in temporary files
+	DEFAULT_MULTIPART_MEMORY = 32 << 20 // 32 MB
+	// Data key the submitted form is exposed under in templates
+	FORM_DATA_KEY = "Form"
+)
+
+// Form holds the submitted values & validation messages of a form bound with
+// `BindForm`. Template routes receive it in their data as `.Form`
+//
+//	<input name="email" value="{{ .Form.Values.email }}">
+//	<span class="error">{{ .Form.Errors.email }}</span>
+type Form struct {
+	Values map[string]string
+	Errors map[string]string
+}
+
+// NewForm creates a Form from the request's submitted values & the error
+// returned by `BindForm`
+func NewForm(r *http.Request, err error) Form {
+	form := Form{
+		Values: map[string]string{},
+		Errors: map[string]string{},
+	}
+	for name, values := range r.Form {
+		if len(values) > 0 {
+			form.Values[name] = values[0]
+		}
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		form.Errors = verr.Fields()
+	}
+	return form
+}
+
+// setFormHolder adds a Form to the request context that `BindForm` fills in
+func setFormHolder(r *http.Request) (*http.Request, *Form) {
+	form := &Form{
+		Values: map[string]string{},
+		Errors: map[string]string{},
+	}
+	ctx := context.WithValue(r.Context(), formKey, form)
+	return r.WithContext(ctx), form
+}
+
+func parseForm(r *http.Request) error {
+	err := r.ParseMultipartForm(DEFAULT_MULTIPART_MEMORY)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+	if isBodyTooLarge(err) {
+		return ErrBodyTooLarge
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBody, err)
+	}
+	return nil
+}
+
+// BindForm decodes an `application/x-www-form-urlencoded` or `multipart/form-data`
+// request into dst, which must be a pointer to a struct. Fields are matched by their
+// `form` tag & converted to the field's type, then validated, see `Validate`.
+// Conversion & validation failures are returned together as a `*ValidationError`.
+//
+// On template routes the submitted values & errors are exposed as `.Form`, so a
+// failed POST can re-render the page with its messages.
+//
+//	type Signup struct {
+//		Email string `form:"email" validate:"required,email"`
+//		Age   int    `form:"age" validate:"min=18"`
+//	}
+//
+//	func signup(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		var s Signup
+//		if err := gomek.BindForm(r, &s); err != nil {
+//			return // .Form.Errors.email is set in the template
+//		}
+//	}
+func BindForm(r *http.Request, dst interface{}) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("gomek: cannot bind a form to %T, expected a pointer to a struct", dst)
+	}
+	var verr ValidationError
+	decodeForm(r.Form, rv.Elem(), "", &verr)
+	err := validate(dst, "form")
+	var validateErr *ValidationError
+	if errors.As(err, &validateErr) {
+		// Fields that couldn't be converted already have an error
+		invalid := verr.Fields()
+		for _, e := range validateErr.Errors {
+			if _, ok := invalid[e.Field]; !ok {
+				verr.Errors = append(verr.Errors, e)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	if len(verr.Errors) > 0 {
+		err = &verr
+	}
+	if form, ok := r.Context().Value(formKey).(*Form); ok {
+		*form = NewForm(r, err)
+	}
+	return err
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func decodeForm(values url.Values, rv reflect.Value, prefix string, verr *ValidationError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := fieldName(f, "form")
+		if name == "" {
+			continue
+		}
+		name = prefix + name
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) && !reflect.PtrTo(f.Type).Implements(textUnmarshalerType) {
+			decodeForm(values, fv, name+".", verr)
+			continue
+		}
+		submitted, ok := values[name]
+		if !ok || len(submitted) == 0 {
+			continue
+		}
+		if err := setFormField(fv, submitted); err != nil {
+			verr.Errors = append(verr.Errors, FieldError{Field: name, Rule: "type", Message: err.Error()})
+		}
+	}
+}
+
+// setFormField converts the submitted values to the field's type
+func setFormField(fv reflect.Value, submitted []string) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(submitted), len(submitted))
+		for i, s := range submitted {
+			if err := setFormValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setFormValue(fv, submitted[0])
+}
+
+func setFormValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		if s == "" {
+			return nil
+		}
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setFormValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		if s == "" {
+			return nil
+		}
+		if fv.Type() == reflect.TypeOf(time.Time{}) {
+			// Dates from <input type="date">
+			if t, err := time.Parse("2006-01-02", s); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		if err := fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return errors.New("is invalid")
+		}
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		// Checkboxes submit "on"
+		if s == "" {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if s == "on" {
+			b, err = true, nil
+		}
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive whole number")
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("has an unsupported type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package gomek
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSignupForm struct {
+	Email    string    `form:"email" validate:"required,email"`
+	Age      int       `form:"age" validate:"min=18"`
+	Terms    bool      `form:"terms"`
+	Tags     []string  `form:"tags"`
+	Birthday time.Time `form:"birthday"`
+	Score    *float64  `form:"score"`
+}
+
+func newFormRequest(values url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestBindForm(t *testing.T) {
+	req := newFormRequest(url.Values{
+		"email":    {"joe@example.com"},
+		"age":      {"21"},
+		"terms":    {"on"},
+		"tags":     {"go", "web"},
+		"birthday": {"2001-02-03"},
+		"score":    {"9.5"},
+	})
+	var signup testSignupForm
+	if err := BindForm(req, &signup); err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	if signup.Email != "joe@example.com" || signup.Age != 21 || !signup.Terms {
+		t.Errorf("Expected joe@example.com, 21 & true got %v", signup)
+	}
+	if len(signup.Tags) != 2 || signup.Tags[1] != "web" {
+		t.Errorf("Expected [go web] got %v", signup.Tags)
+	}
+	if signup.Birthday.Format("2006-01-02") != "2001-02-03" {
+		t.Errorf("Expected 2001-02-03 got %v", signup.Birthday)
+	}
+	if signup.Score == nil || *signup.Score != 9.5 {
+		t.Errorf("Expected 9.5 got %v", signup.Score)
+	}
+}
+
+func TestBindFormErrors(t *testing.T) {
+	req := newFormRequest(url.Values{
+		"email": {"joe"},
+		"age":   {"twenty"},
+	})
+	var signup testSignupForm
+	err := BindForm(req, &signup)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError got %v", err)
+	}
+	fields := verr.Fields()
+	if fields["email"] != "must be a valid email address" {
+		t.Errorf("Expected must be a valid email address got '%s'", fields["email"])
+	}
+	if fields["age"] != "must be a whole number" {
+		t.Errorf("Expected must be a whole number got '%s'", fields["age"])
+	}
+}
+
+func TestBindFormMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("email", "joe@example.com")
+	mw.WriteField("age", "30")
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/signup", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var signup testSignupForm
+	if err := BindForm(req, &signup); err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	if signup.Email != "joe@example.com" || signup.Age != 30 {
+		t.Errorf("Expected joe@example.com & 30 got %v", signup)
+	}
+}
+
+func TestBindFormTemplate(t *testing.T) {
+	layout := filepath.Join(t.TempDir(), "layout.gohtml")
+	tmpl := `{{ define "layout" }}{{ .Form.Values.email }}: {{ .Form.Errors.email }}{{ end }}`
+	if err := os.WriteFile(layout, []byte(tmpl), 0600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	mockApp := NewTestApp(Config{})
+	mockApp.Route("/signup").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		if r.Method == "POST" {
+			var signup testSignupForm
+			BindForm(r, &signup)
+		}
+	}).Methods("GET", "POST").Templates(layout)
+	mockApp.Start()
+
+	w := httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, newFormRequest(url.Values{"email": {"joe"}}))
+	expected := "joe: must be a valid email address"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+
+	// Pages that haven't bound a form still get an empty .Form
+	w = httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/signup", nil))
+	if w.Body.String() != ": " {
+		t.Errorf("Expected an empty form got '%v'", w.Body.String())
+	}
+}
@@ -1,5 +1,3 @@
 module github.com/joegasewicz/gomek
 
 go 1.18
-
-require github.com/joegasewicz/status-writer v0.1.0 // indirect
@@ -2,17 +2,33 @@ package gomek
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const (
-	DEFAULT_BASE_TEMPLATE = "layout"
-	DEFAULT_HOST          = "localhost"
-	DEFAULT_PORT          = 5000
-	DEFAULT_PROTOCOL      = "http"
+	DEFAULT_BASE_TEMPLATE    = "layout"
+	DEFAULT_HOST             = "localhost"
+	DEFAULT_PORT             = 5000
+	DEFAULT_PROTOCOL         = "http"
+	DEFAULT_SHUTDOWN_TIMEOUT = 10 * time.Second
+	// Server limits, a negative Config value disables the limit
+	DEFAULT_READ_TIMEOUT        = 15 * time.Second
+	DEFAULT_READ_HEADER_TIMEOUT = 5 * time.Second
+	DEFAULT_WRITE_TIMEOUT       = 30 * time.Second
+	DEFAULT_IDLE_TIMEOUT        = 60 * time.Second
+	DEFAULT_MAX_HEADER_BYTES    = 1 << 20  // 1 MB
+	DEFAULT_MAX_BODY_BYTES      = 10 << 20 // 10 MB
 )
 
 var (
@@ -32,11 +48,57 @@ type Handle func(pattern string, handler http.Handler)
 
 type Middleware []func(http.Handler) http.HandlerFunc
 
+// contextKey is the type of the request values gomek stores for itself, so a
+// string key set by the app, e.g. "client", can't replace them
+type contextKey string
+
+const (
+	cacheTagsKey contextKey = "cacheTags"
+	clientKey    contextKey = "client"
+	connKey      contextKey = "conn"
+	cspNonceKey  contextKey = "cspNonce"
+	formKey      contextKey = "form"
+	routeKey     contextKey = "route"
+	spanKey      contextKey = "span"
+	uploadsKey   contextKey = "uploads"
+)
+
 // Config type that should be passed to `gomek.New`
 type Config struct {
 	BaseTemplateName string
 	BaseTemplates    []string
 	Debug            bool
+	// ShutdownTimeout is how long in-flight requests are given to finish once
+	// the server starts shutting down. Defaults to `DEFAULT_SHUTDOWN_TIMEOUT`.
+	ShutdownTimeout time.Duration
+	// Server timeouts & limits. Zero values are replaced by their `DEFAULT_*`
+	// counterparts, a negative value disables the timeout or limit.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// MaxBodyBytes is the largest request body a view will read.
+	MaxBodyBytes int64
+	// TLSCertFile & TLSKeyFile serve the app over HTTPS. The pair is reloaded
+	// from disk when the process receives a SIGHUP.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TemplateFuncs are added to every route's templates, along with gomek's
+	// own functions such as `static`.
+	TemplateFuncs template.FuncMap
+	// TrustedProxies are the CIDRs or IP addresses of the proxies & load balancers
+	// in front of the app. Their forwarding headers are used by `ClientIP` & `RequestURL`.
+	// `TRUSTED_PROXY_UNIX` trusts proxies connected over a Unix socket.
+	TrustedProxies []string
+	// CacheStore holds the responses of routes using `App.Cache`. Defaults to a
+	// `MemoryCache` of `DEFAULT_CACHE_SIZE` entries.
+	CacheStore CacheStore
+	// TLSConfig replaces gomek's default TLS 1.2+ configuration.
+	TLSConfig *tls.Config
+	// HTTPRedirectPort starts a plain HTTP listener on this port that redirects
+	// all requests to HTTPS. Only used when TLS is enabled.
+	HTTPRedirectPort int
 }
 
 type Resource interface {
@@ -56,16 +118,35 @@ type IApp interface {
 	resetCurrentView()
 	cloneRoute()
 	Start() error
+	Run(ctx context.Context) error
 	SetHost(host string)
 	Listen(port int)
+	ListenAddr(addrs ...string)
+	Serve(l net.Listener) error
 	Methods(methods ...string) *App
 	Route(route string) *App
-	Templates(templates ...string)
+	Templates(templates ...string) *App
 	BaseTemplates(templates ...string)
 	View(view CurrentView) *App
 	Resource(m Resource) *App
+	Timeout(d time.Duration) *App
+	WebSocket(handler WebSocketHandler, opts ...WebSocketOption) *App
+	Uploads(opts UploadOptions) *App
+	ETag(opts ...ETagOptions) *App
+	Cache(ttl time.Duration, varyBy ...string) *App
+	PurgeCache(tags ...string)
+	RateLimit(opts RateLimitOptions) *App
+	SecureHeaders(opts SecureHeadersOptions) *App
+	IPFilter(allow []string, deny []string) *App
+	Static(prefix string, root interface{}, opts ...StaticOptions)
+	SPA(prefix string, root interface{}, index string, opts ...StaticOptions)
 	Use(h func(http.Handler) http.HandlerFunc)
-	Shutdown()
+	BeforeRequest(hook func(w http.ResponseWriter, r *http.Request) bool)
+	AfterRequest(hook func(w http.ResponseWriter, r *http.Request, status int))
+	Teardown(hook func(r *http.Request, err error))
+	OnStart(hook func(ctx context.Context) error)
+	OnShutdown(hook func(ctx context.Context) error)
+	Shutdown() error
 	GetView() *View
 	GetConfig() *Config
 }
@@ -79,16 +160,36 @@ type App struct {
 	currentTemplates []string
 	currentView      CurrentView
 	currentResource  Resource
-	Mux              *http.ServeMux
-	Host             string
-	Port             int
-	Protocol         string
-	view             View
-	Handle           Handle
-	middleware       Middleware
-	rootCtx          context.Context
-	authCtx          context.Context
-	server           *http.Server
+	currentTimeout   time.Duration
+	currentUploads   *UploadOptions
+	// Middleware for the current route only
+	currentMiddleware Middleware
+	currentCache      func(http.Handler) http.HandlerFunc
+	statics           []*staticFiles
+	spas              []*spaFiles
+	cacheOnce         sync.Once
+	rateLimitOnce     sync.Once
+	rateLimits        RateLimitStore
+	Mux               *http.ServeMux
+	Host              string
+	Port              int
+	Protocol          string
+	view              View
+	Handle            Handle
+	middleware        Middleware
+	rootCtx           context.Context
+	authCtx           context.Context
+	server            *http.Server
+	redirectServer    *http.Server
+	certs             *certReloader
+	addrs             []string
+	listeners         []net.Listener
+	shutdownHooks     []func(ctx context.Context) error
+	startHooks        []func(ctx context.Context) error
+	// Request hooks
+	beforeRequestHooks []func(w http.ResponseWriter, r *http.Request) bool
+	afterRequestHooks  []func(w http.ResponseWriter, r *http.Request, status int)
+	teardownHooks      []func(r *http.Request, err error)
 	// Final registeredTemplates
 	registeredTemplates []RegisteredTemplates
 }
@@ -97,6 +198,14 @@ func createAddr(a *App) string {
 	return fmt.Sprintf("%s:%d", a.Host, a.Port)
 }
 
+// limit returns the configured value, or 0 (no limit) for negative values
+func limit[T time.Duration | int | int64](v T) T {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
 func (a *App) GetView() *View {
 	return &a.view
 }
@@ -138,10 +247,49 @@ func (a *App) setup() *http.Server {
 	if a.Protocol == "" {
 		a.Protocol = DEFAULT_PROTOCOL
 	}
+	if a.Config.ShutdownTimeout == 0 {
+		a.Config.ShutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	if a.Config.ReadTimeout == 0 {
+		a.Config.ReadTimeout = DEFAULT_READ_TIMEOUT
+	}
+	if a.Config.ReadHeaderTimeout == 0 {
+		a.Config.ReadHeaderTimeout = DEFAULT_READ_HEADER_TIMEOUT
+	}
+	if a.Config.WriteTimeout == 0 {
+		a.Config.WriteTimeout = DEFAULT_WRITE_TIMEOUT
+	}
+	if a.Config.IdleTimeout == 0 {
+		a.Config.IdleTimeout = DEFAULT_IDLE_TIMEOUT
+	}
+	if a.Config.MaxHeaderBytes == 0 {
+		a.Config.MaxHeaderBytes = DEFAULT_MAX_HEADER_BYTES
+	}
+	if a.Config.MaxBodyBytes == 0 {
+		a.Config.MaxBodyBytes = DEFAULT_MAX_BODY_BYTES
+	}
+	// Template functions, the app's own take precedence
+	funcs := template.FuncMap{
+		"static": a.staticURL,
+	}
+	for name, f := range a.Config.TemplateFuncs {
+		funcs[name] = f
+	}
+	a.Config.TemplateFuncs = funcs
 	// Create views
 	for _, v := range a.view.StoredViews {
 		a.view.Create(a, v)
 	}
+	// Static files
+	for _, s := range a.statics {
+		a.Mux.Handle(s.prefix, a.wrapMiddleware(s.ServeHTTP))
+	}
+	// Single page apps, routes take precedence over their fallback
+	roots := a.routeRoots()
+	for _, s := range a.spas {
+		s.reserved = roots
+		a.Mux.Handle(s.prefix, a.wrapMiddleware(s.ServeHTTP))
+	}
 
 	// Log registeredTemplates
 	if a.Config.Debug {
@@ -152,27 +300,63 @@ func (a *App) setup() *http.Server {
 	// Server
 	return &http.Server{
 		Addr:              address,
-		Handler:           a.Mux,
+		Handler:           a.rootHandler(),
 		TLSConfig:         nil,
-		ReadTimeout:       0,
-		ReadHeaderTimeout: 0,
-		WriteTimeout:      0,
-		IdleTimeout:       0,
-		MaxHeaderBytes:    0,
+		ReadTimeout:       limit(a.Config.ReadTimeout),
+		ReadHeaderTimeout: limit(a.Config.ReadHeaderTimeout),
+		WriteTimeout:      limit(a.Config.WriteTimeout),
+		IdleTimeout:       limit(a.Config.IdleTimeout),
+		MaxHeaderBytes:    limit(a.Config.MaxHeaderBytes),
 		TLSNextProto:      nil,
 		ConnState:         nil,
 		ErrorLog:          nil,
 		BaseContext:       nil,
-		ConnContext:       nil,
+		ConnContext:       withConn,
 	}
 }
 
+// rootHandler serves the Mux. Requests that don't match any route are passed
+// through the middleware to the not found handler.
+func (a *App) rootHandler() http.HandlerFunc {
+	notFoundHandler := a.wrapMiddleware(notFound)
+	proxies := a.trustedProxies()
+	patterns := a.routePatterns()
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = setClient(r, proxies)
+		_, pattern := a.Mux.Handler(r)
+		if route, ok := patterns[pattern]; ok {
+			pattern = route
+		}
+		r = r.WithContext(context.WithValue(r.Context(), routeKey, pattern))
+		if pattern == "" {
+			notFoundHandler(w, r)
+			return
+		}
+		a.Mux.ServeHTTP(w, r)
+	}
+}
+
+// wrapMiddleware passes handlers that aren't views, such as static files, through
+// the app's middleware & request hooks
+func (a *App) wrapMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	for _, m := range a.middleware {
+		if m != nil {
+			handler = traceMiddleware(m)(handler)
+		}
+	}
+	return a.wrapHooks(handler)
+}
+
 func (a *App) resetCurrentView() {
 	a.currentRoute = ""
 	a.currentMethods = nil
 	a.baseTemplates = nil
 	a.currentView = nil
 	a.currentTemplates = nil
+	a.currentTimeout = 0
+	a.currentUploads = nil
+	a.currentMiddleware = nil
+	a.currentCache = nil
 }
 
 func (a *App) cloneRoute() {
@@ -256,8 +440,9 @@ func (a *App) Route(route string) *App {
 //		.Templates("./registeredTemplates/hero.html", "./registeredTemplates/routes/home.html")
 //
 // The above example adds a `hero.html` partial template & a main route `home.html` template.
-func (a *App) Templates(templates ...string) {
+func (a *App) Templates(templates ...string) *App {
 	a.currentTemplates = templates
+	return a
 }
 
 // BaseTemplates method accepts slices of string, string if the name of the
@@ -327,6 +512,16 @@ func (a *App) Resource(m Resource) *App {
 	return a
 }
 
+// Timeout sets the maximum duration the current route's view may run for. Once
+// exceeded the request context is cancelled & a 503 Service Unavailable is returned,
+// unless the view has already started its response, e.g. an `SSE` stream.
+//
+//	app.Route("/reports").View(Reports).Methods("GET").Timeout(5 * time.Second)
+func (a *App) Timeout(d time.Duration) *App {
+	a.currentTimeout = d
+	return a
+}
+
 // Use adds middleware.
 //
 //	app := gomek.New(gomek.Config{})
@@ -335,14 +530,50 @@ func (a *App) Use(h func(http.Handler) http.HandlerFunc) {
 	a.middleware = append(a.middleware, h)
 }
 
-// Shutdown force shutdown of the Mux server
+// OnShutdown registers a hook that is called after the server has stopped accepting
+// connections & in-flight requests have drained. Hooks run in the order they were
+// registered & each one receives a context bounded by `Config.ShutdownTimeout`.
+//
+//	app.OnShutdown(func(ctx context.Context) error {
+//		return db.Close()
+//	})
+func (a *App) OnShutdown(hook func(ctx context.Context) error) {
+	a.shutdownHooks = append(a.shutdownHooks, hook)
+}
+
+// Shutdown gracefully shuts down the Mux server. New connections are refused &
+// in-flight requests are given `Config.ShutdownTimeout` to finish before the
+// remaining connections are closed. The registered shutdown hooks are then run.
+// The first error encountered is returned.
 //
-//	app.Shutdown()
-func (a *App) Shutdown() {
-	err := a.server.Shutdown(a.rootCtx)
+//	err := app.Shutdown()
+func (a *App) Shutdown() error {
+	if a.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(a.rootCtx, a.Config.ShutdownTimeout)
+	defer cancel()
+	if a.redirectServer != nil {
+		a.redirectServer.Shutdown(ctx)
+	}
+	a.closeCerts()
+	err := a.server.Shutdown(ctx)
 	if err != nil {
-		log.Fatalln("error shutting down", err)
+		log.Println("[GOMEK] Error draining connections", err)
+		a.server.Close()
+	}
+	// Hooks get their own deadline so a slow drain doesn't starve them
+	hookCtx, hookCancel := context.WithTimeout(a.rootCtx, a.Config.ShutdownTimeout)
+	defer hookCancel()
+	for _, hook := range a.shutdownHooks {
+		if hookErr := hook(hookCtx); hookErr != nil {
+			log.Println("[GOMEK] Error running shutdown hook", hookErr)
+			if err == nil {
+				err = hookErr
+			}
+		}
 	}
+	return err
 }
 
 // Args access the request arguments in a handler as a map
@@ -379,23 +610,108 @@ type _App struct {
 	*App
 }
 
-// Start sets up all the registered views, registeredTemplates & middleware
+// Start sets up all the registered views, registeredTemplates & middleware. If
+// a listener fails the server is shut down & the error returned.
 //
 //	app = gomek.New(gomek.Config{})
 //	app.Start()
 func (a *App) Start() error {
 	// Start server...
-	a.server = a.setup()
-	msg := fmt.Sprintf("[GOMEK] Starting server on %s://%s", a.Protocol, a.server.Addr)
-	out := PrintWithColor(msg, BLUE)
-	log.Printf(out)
-	err := a.server.ListenAndServe()
+	serveErr, err := a.startServer()
+	if err == nil {
+		err = <-serveErr
+		if !errors.Is(err, http.ErrServerClosed) {
+			// Stop the listeners that are still serving
+			a.Shutdown()
+		}
+	}
 	if err != nil {
 		log.Println("[GOMEK] Error starting gomek server", err)
 	}
 	return err
 }
 
+// startServer sets up the app & serves it in the background. Errors returned
+// by the listeners are sent to the returned channel.
+func (a *App) startServer() (<-chan error, error) {
+	a.server = a.setup()
+	if err := a.runStartHooks(); err != nil {
+		return nil, err
+	}
+	if err := a.setupTLS(); err != nil {
+		return nil, err
+	}
+	listeners, err := a.openListeners()
+	if err != nil {
+		a.closeCerts()
+		return nil, err
+	}
+	var redirectListener net.Listener
+	if a.redirectServer != nil {
+		// Opened before serving so a taken port fails startup
+		if redirectListener, err = net.Listen("tcp", a.redirectServer.Addr); err != nil {
+			for _, l := range listeners[len(a.listeners):] {
+				l.Close()
+			}
+			a.closeCerts()
+			return nil, err
+		}
+		a.redirectServer.Handler = redirectToHTTPS(httpsPort(listeners, a.Port))
+	}
+	serveErr := make(chan error, len(listeners)+1)
+	// Read before serving, the server's TLS config is updated by each Serve call
+	useTLS := a.server.TLSConfig != nil
+	for _, l := range listeners {
+		msg := fmt.Sprintf("[GOMEK] Starting server on %s", listenerURL(a.Protocol, l))
+		out := PrintWithColor(msg, BLUE)
+		log.Printf(out)
+		go func(l net.Listener) {
+			if useTLS {
+				serveErr <- a.server.ServeTLS(l, "", "")
+				return
+			}
+			serveErr <- a.server.Serve(l)
+		}(l)
+	}
+	if redirectListener != nil {
+		go func() {
+			serveErr <- a.redirectServer.Serve(redirectListener)
+		}()
+	}
+	return serveErr, nil
+}
+
+// Run starts the server & blocks until ctx is cancelled or the process receives
+// a SIGINT or SIGTERM. The server is then shut down gracefully, see `Shutdown`.
+// Unlike `Start`, Run returns nil once the server has stopped cleanly.
+//
+//	app = gomek.New(gomek.Config{ShutdownTimeout: 5 * time.Second})
+//	if err := app.Run(context.Background()); err != nil {
+//		log.Println(err)
+//	}
+func (a *App) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr, err := a.startServer()
+	if err != nil {
+		log.Println("[GOMEK] Error starting gomek server", err)
+		return err
+	}
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		log.Println("[GOMEK] Error starting gomek server", err)
+		a.Shutdown()
+		return err
+	case <-ctx.Done():
+	}
+	out := PrintWithColor("[GOMEK] Shutting down server", BLUE)
+	log.Printf(out)
+	return a.Shutdown()
+}
+
 // New creates a new gomek application
 //
 //	app := gomek.New(gomek.Config{})
@@ -1 +1,141 @@
 package gomek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func waitForServer(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server on %s never started", addr)
+}
+
+func TestApp_Run(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app := New(Config{})
+	app.SetHost("127.0.0.1")
+	app.Listen(freePort(t))
+	app.Route("/slow").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		close(started)
+		<-release
+		JSON(w, map[string]string{"name": "Joe"}, http.StatusOK)
+	}).Methods("GET")
+	var hookCalled bool
+	app.OnShutdown(func(ctx context.Context) error {
+		hookCalled = true
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx)
+	}()
+	addr := fmt.Sprintf("127.0.0.1:%d", app.Port)
+	waitForServer(t, addr)
+
+	respStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			respStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		respStatus <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if status := <-respStatus; status != http.StatusOK {
+		t.Errorf("expected in-flight request to drain with %d got %d", http.StatusOK, status)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+	if !hookCalled {
+		t.Errorf("expected shutdown hook to be called")
+	}
+}
+
+func TestApp_RunShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	app := New(Config{ShutdownTimeout: 50 * time.Millisecond})
+	app.SetHost("127.0.0.1")
+	app.Listen(freePort(t))
+	app.Route("/stuck").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		close(started)
+		<-release
+	}).Methods("GET")
+	hookErr := errors.New("hook failed")
+	app.OnShutdown(func(ctx context.Context) error {
+		return hookErr
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx)
+	}()
+	addr := fmt.Sprintf("127.0.0.1:%d", app.Port)
+	waitForServer(t, addr)
+	go http.Get("http://" + addr + "/stuck")
+	<-started
+	cancel()
+
+	err := <-runErr
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestApp_ShutdownNotStarted(t *testing.T) {
+	app := New(Config{})
+	if err := app.Shutdown(); err != nil {
+		t.Errorf("expected nil got %v", err)
+	}
+}
+
+func TestApp_setupServerLimits(t *testing.T) {
+	app := New(Config{WriteTimeout: -1, MaxHeaderBytes: 512})
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	server := app.setup()
+	if server.ReadHeaderTimeout != DEFAULT_READ_HEADER_TIMEOUT {
+		t.Errorf("expected %v got %v", DEFAULT_READ_HEADER_TIMEOUT, server.ReadHeaderTimeout)
+	}
+	if server.WriteTimeout != 0 {
+		t.Errorf("expected a disabled write timeout got %v", server.WriteTimeout)
+	}
+	if server.MaxHeaderBytes != 512 {
+		t.Errorf("expected %d got %d", 512, server.MaxHeaderBytes)
+	}
+	if app.Config.MaxBodyBytes != DEFAULT_MAX_BODY_BYTES {
+		t.Errorf("expected %d got %d", DEFAULT_MAX_BODY_BYTES, app.Config.MaxBodyBytes)
+	}
+}
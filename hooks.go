@@ -0,0 +1,158 @@
+package gomek
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// hookWriter runs the after request hooks once, just before the status & headers are sent
+type hookWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	hooks       []func(w http.ResponseWriter, r *http.Request, status int)
+	wroteHeader bool
+}
+
+func (h *hookWriter) WriteHeader(status int) {
+	if h.wroteHeader {
+		return
+	}
+	h.wroteHeader = true
+	// Run in reverse order of registration, like Flask
+	for i := len(h.hooks) - 1; i >= 0; i-- {
+		h.hooks[i](h.ResponseWriter, h.r, status)
+	}
+	h.ResponseWriter.WriteHeader(status)
+}
+
+func (h *hookWriter) Write(b []byte) (int, error) {
+	if !h.wroteHeader {
+		h.WriteHeader(http.StatusOK)
+	}
+	return h.ResponseWriter.Write(b)
+}
+
+func (h *hookWriter) Flush() {
+	if !h.wroteHeader {
+		h.WriteHeader(http.StatusOK)
+	}
+	flush(h.ResponseWriter)
+}
+
+func (h *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := hijack(h.ResponseWriter)
+	if err == nil {
+		// The connection is handed over so no headers will be written
+		h.wroteHeader = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (h *hookWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// BeforeRequest registers a hook that is called before the middleware & view of
+// every route. Return false to stop handling the request, the hook is then
+// responsible for writing the response.
+//
+//	app.BeforeRequest(func(w http.ResponseWriter, r *http.Request) bool {
+//		if r.Header.Get("X-API-Key") == "" {
+//			w.WriteHeader(http.StatusForbidden)
+//			return false
+//		}
+//		return true
+//	})
+func (a *App) BeforeRequest(hook func(w http.ResponseWriter, r *http.Request) bool) {
+	a.beforeRequestHooks = append(a.beforeRequestHooks, hook)
+}
+
+// AfterRequest registers a hook that is called with the response status just
+// before the status & headers are written, so it can still change the headers.
+// Hooks are called in reverse order of registration.
+//
+//	app.AfterRequest(func(w http.ResponseWriter, r *http.Request, status int) {
+//		w.Header().Set("X-Powered-By", "gomek")
+//	})
+func (a *App) AfterRequest(hook func(w http.ResponseWriter, r *http.Request, status int)) {
+	a.afterRequestHooks = append(a.afterRequestHooks, hook)
+}
+
+// Teardown registers a hook that is called once the request has been handled,
+// even if the view or a middleware panicked. err is non nil after a panic, which
+// is re-raised once the teardown hooks have run. Hooks are called in reverse
+// order of registration.
+//
+//	app.Teardown(func(r *http.Request, err error) {
+//		if err != nil {
+//			log.Println("request failed", err)
+//		}
+//	})
+func (a *App) Teardown(hook func(r *http.Request, err error)) {
+	a.teardownHooks = append(a.teardownHooks, hook)
+}
+
+// OnStart registers a hook that is called once the app is set up, before the
+// server accepts connections. An error stops the server from starting.
+//
+//	app.OnStart(func(ctx context.Context) error {
+//		return db.Ping()
+//	})
+func (a *App) OnStart(hook func(ctx context.Context) error) {
+	a.startHooks = append(a.startHooks, hook)
+}
+
+func (a *App) runStartHooks() error {
+	for _, hook := range a.startHooks {
+		if err := hook(a.rootCtx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapHooks wraps a route's handler, including its middleware, with the request hooks
+func (a *App) wrapHooks(next http.HandlerFunc) http.HandlerFunc {
+	before := a.beforeRequestHooks
+	after := a.afterRequestHooks
+	teardown := a.teardownHooks
+	if len(before) == 0 && len(after) == 0 && len(teardown) == 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(teardown) > 0 {
+			defer func() {
+				rec := recover()
+				var err error
+				if rec != nil {
+					err = fmt.Errorf("panic: %v", rec)
+				}
+				for i := len(teardown) - 1; i >= 0; i-- {
+					teardown[i](r, err)
+				}
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+		}
+		for _, hook := range before {
+			if !hook(w, r) {
+				return
+			}
+		}
+		if len(after) == 0 {
+			next(w, r)
+			return
+		}
+		hw := &hookWriter{ResponseWriter: w, r: r, hooks: after}
+		next(hw, r)
+		// Nothing was written so the response is an implicit 200
+		if !hw.wroteHeader {
+			hw.WriteHeader(http.StatusOK)
+		}
+	}
+}
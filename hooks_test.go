@@ -0,0 +1,103 @@
+package gomek
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApp_BeforeRequest(t *testing.T) {
+	mockApp := NewTestApp(Config{})
+	var viewCalled bool
+	mockApp.Route("/blogs").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		viewCalled = true
+	}).Methods("GET")
+	mockApp.BeforeRequest(func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	})
+	mockApp.Start()
+
+	req := httptest.NewRequest(http.MethodGet, "/blogs", nil)
+	w := httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected %d got %d", http.StatusForbidden, w.Code)
+	}
+	if viewCalled {
+		t.Errorf("Expected the view not to be called")
+	}
+}
+
+func TestApp_AfterRequest(t *testing.T) {
+	mockApp := NewTestApp(Config{})
+	mockApp.Route("/blogs").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "Joe"}, http.StatusCreated)
+	}).Methods("GET")
+	var order []string
+	mockApp.AfterRequest(func(w http.ResponseWriter, r *http.Request, status int) {
+		order = append(order, "first")
+		w.Header().Set("X-Status", http.StatusText(status))
+	})
+	mockApp.AfterRequest(func(w http.ResponseWriter, r *http.Request, status int) {
+		order = append(order, "second")
+	})
+	mockApp.Start()
+
+	req := httptest.NewRequest(http.MethodGet, "/blogs", nil)
+	w := httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, req)
+
+	if value := w.Header().Get("X-Status"); value != "Created" {
+		t.Errorf("Expected Created got %s", value)
+	}
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("Expected hooks in reverse order got %v", order)
+	}
+	expected := `{"name":"Joe"}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+}
+
+func TestApp_TeardownAfterPanic(t *testing.T) {
+	mockApp := NewTestApp(Config{})
+	mockApp.Route("/blogs").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		panic("boom")
+	}).Methods("GET")
+	var teardownErr error
+	mockApp.Teardown(func(r *http.Request, err error) {
+		teardownErr = err
+	})
+	mockApp.Start()
+
+	req := httptest.NewRequest(http.MethodGet, "/blogs", nil)
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Errorf("Expected the panic to be re-raised got %v", rec)
+			}
+		}()
+		mockApp.(*TestApp).Mux.ServeHTTP(w, req)
+	}()
+
+	if teardownErr == nil || teardownErr.Error() != "panic: boom" {
+		t.Errorf("Expected panic: boom got %v", teardownErr)
+	}
+}
+
+func TestApp_OnStartError(t *testing.T) {
+	app := New(Config{})
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	startErr := errors.New("database unavailable")
+	app.OnStart(func(ctx context.Context) error {
+		return startErr
+	})
+	if err := app.Run(context.Background()); err != startErr {
+		t.Errorf("Expected %v got %v", startErr, err)
+	}
+}
@@ -0,0 +1,48 @@
+package gomek
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// IPFilter only allows clients whose IP address is in allow & not in deny, others
+// get a 403 Forbidden. Both take CIDRs or single IPv4 & IPv6 addresses, an empty
+// allow list allows every address that isn't denied. The client's address is
+// resolved with `ClientIP`, so set `Config.TrustedProxies` behind a load balancer.
+//
+//	app.Use(gomek.IPFilter(nil, []string{"203.0.113.0/24"}))
+func IPFilter(allow []string, deny []string) func(next http.Handler) http.HandlerFunc {
+	allowed, err := parseNetworks(allow)
+	if err == nil {
+		var denied []*net.IPNet
+		if denied, err = parseNetworks(deny); err == nil {
+			return ipFilter(allowed, denied)
+		}
+	}
+	out := fmt.Sprintf("[GOMEK]: Error parsing IPFilter: %v", err)
+	log.Fatalf(PrintWithColor(out, RED))
+	return nil
+}
+
+func ipFilter(allowed []*net.IPNet, denied []*net.IPNet) func(next http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := net.ParseIP(ClientIP(r))
+			if ip == nil || ipInNetworks(denied, ip) || (len(allowed) > 0 && !ipInNetworks(allowed, ip)) {
+				httpError(w, r, http.StatusForbidden, "your IP address is not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPFilter restricts the current route to the allowed IP addresses, see `gomek.IPFilter`
+//
+//	app.Route("/admin").View(admin).Methods("GET").IPFilter([]string{"10.8.0.0/16", "fd00:8::/32"}, nil)
+func (a *App) IPFilter(allow []string, deny []string) *App {
+	a.currentMiddleware = append(a.currentMiddleware, IPFilter(allow, deny))
+	return a
+}
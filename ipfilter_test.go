@@ -0,0 +1,111 @@
+package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPFilter(t *testing.T) {
+	handler := IPFilter([]string{"10.8.0.0/16", "fd00:8::/32", "192.0.2.7"}, []string{"10.8.5.0/24"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := map[string]int{
+		"10.8.1.2:1234":        http.StatusOK,
+		"192.0.2.7:1234":       http.StatusOK,
+		"[fd00:8::1]:1234":     http.StatusOK,
+		"[::ffff:10.8.1.2]:80": http.StatusOK,
+		"10.8.5.9:1234":        http.StatusForbidden,
+		"10.9.0.1:1234":        http.StatusForbidden,
+		"[fd00:9::1]:1234":     http.StatusForbidden,
+		"192.0.2.8:1234":       http.StatusForbidden,
+	}
+	for remoteAddr, status := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		handler(w, req)
+		if w.Code != status {
+			t.Errorf("%s: expected %d got %d", remoteAddr, status, w.Code)
+		}
+	}
+
+	denyOnly := IPFilter(nil, []string{"203.0.113.0/24"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for remoteAddr, status := range map[string]int{"203.0.113.5:1": http.StatusForbidden, "198.51.100.1:1": http.StatusOK} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		denyOnly(w, req)
+		if w.Code != status {
+			t.Errorf("%s: expected %d got %d", remoteAddr, status, w.Code)
+		}
+	}
+}
+
+func TestIPFilterRoute(t *testing.T) {
+	app := New(Config{TrustedProxies: []string{"10.0.0.1"}})
+	view := func(w http.ResponseWriter, r *http.Request, d *Data) {}
+	app.Route("/admin").View(view).Methods("GET").IPFilter([]string{"172.16.0.0/12"}, nil)
+	app.Route("/").View(view).Methods("GET")
+	handler := app.setup().Handler
+
+	tests := []struct {
+		target    string
+		forwarded string
+		status    int
+	}{
+		{"/admin", "172.16.4.4", http.StatusOK},
+		{"/admin", "203.0.113.5", http.StatusForbidden},
+		{"/", "203.0.113.5", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", tt.forwarded)
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s from %s: expected %d got %d", tt.target, tt.forwarded, tt.status, w.Code)
+		}
+	}
+	// Untrusted peers are filtered by their own address, not the forwarded one
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	req.Header.Set("X-Forwarded-For", "172.16.4.4")
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a spoofed header to be ignored got %d", w.Code)
+	}
+}
+
+func TestIPFilterRouteCache(t *testing.T) {
+	app := New(Config{TrustedProxies: []string{"10.0.0.1"}})
+	app.Route("/admin").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		w.Write([]byte("secret"))
+	}).Methods("GET").IPFilter([]string{"10.0.0.0/8"}, nil).Cache(time.Minute)
+	handler := app.setup().Handler
+
+	tests := []struct {
+		forwarded string
+		status    int
+		cache     string
+	}{
+		{"10.1.1.1", http.StatusOK, "MISS"},
+		{"203.0.113.5", http.StatusForbidden, ""},
+		{"10.1.1.1", http.StatusOK, "HIT"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", tt.forwarded)
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Header().Get(CACHE_STATUS_HEADER) != tt.cache {
+			t.Errorf("%s: expected %d %q got %d %q", tt.forwarded, tt.status, tt.cache, w.Code, w.Header().Get(CACHE_STATUS_HEADER))
+		}
+		if tt.status == http.StatusForbidden && strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s: expected the cached page to be filtered got %s", tt.forwarded, w.Body.String())
+		}
+	}
+}
@@ -1,25 +1,149 @@
 package gomek
 
 import (
+	"bufio"
 	"encoding/json"
-	"fmt"
 	"log"
+	"net"
 	"net/http"
 )
 
-func JSON(w http.ResponseWriter, schema interface{}, status int) {
-	j, err := json.Marshal(schema)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println(err)
-		return
+// JSON_SAFE_PREFIX can be written before a JSON response so it can't be executed
+// as a script by another site. Clients strip it before parsing.
+const JSON_SAFE_PREFIX = ")]}',\n"
+
+// JSONOptions configures how `JSON` & `JSONStatus` encode a response
+type JSONOptions struct {
+	// Indent pretty prints the response, "" writes compact JSON
+	Indent string
+	// EscapeHTML escapes <, > & & inside strings
+	EscapeHTML bool
+	// Prefix is written before the JSON, e.g. `JSON_SAFE_PREFIX`
+	Prefix string
+}
+
+// JSONOption changes a single JSONOptions value
+type JSONOption func(o *JSONOptions)
+
+// JSONIndent pretty prints the response with indent
+//
+//	gomek.JSON(w, notice, http.StatusOK, gomek.JSONIndent("  "))
+func JSONIndent(indent string) JSONOption {
+	return func(o *JSONOptions) {
+		o.Indent = indent
+	}
+}
+
+// JSONEscapeHTML sets whether <, > & & are escaped inside strings. Defaults to true.
+func JSONEscapeHTML(escape bool) JSONOption {
+	return func(o *JSONOptions) {
+		o.EscapeHTML = escape
+	}
+}
+
+// JSONPrefix writes prefix before the JSON
+//
+//	gomek.JSON(w, notice, http.StatusOK, gomek.JSONPrefix(gomek.JSON_SAFE_PREFIX))
+func JSONPrefix(prefix string) JSONOption {
+	return func(o *JSONOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// DefaultJSONOptions are used by `JSON` & `JSONStatus` before any JSONOption is
+// applied. The views of apps started with `Config.Debug` also pretty print responses.
+var DefaultJSONOptions = JSONOptions{
+	EscapeHTML: true,
+}
+
+// debugWriter is passed to the views of apps started with `Config.Debug`, so
+// `JSONStatus` pretty prints for that app only
+type debugWriter struct {
+	http.ResponseWriter
+}
+
+func (d *debugWriter) Flush() {
+	flush(d.ResponseWriter)
+}
+
+func (d *debugWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(d.ResponseWriter)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (d *debugWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// debugJSON reports whether w was passed to a view of a `Config.Debug` app
+func debugJSON(w http.ResponseWriter) bool {
+	for {
+		if _, ok := w.(*debugWriter); ok {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// jsonWriter writes the status & prefix on the first write, so an encoding error
+// can still be returned as a 500
+type jsonWriter struct {
+	w           http.ResponseWriter
+	status      int
+	prefix      string
+	wroteHeader bool
+}
+
+func (j *jsonWriter) Write(b []byte) (int, error) {
+	if !j.wroteHeader {
+		j.wroteHeader = true
+		j.w.WriteHeader(j.status)
+		if j.prefix != "" {
+			if _, err := j.w.Write([]byte(j.prefix)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return j.w.Write(b)
+}
+
+// JSONStatus encodes schema straight to w as JSON with the given status. If schema
+// can't be encoded a 500 is written instead & the error is returned, as are errors
+// writing the response.
+//
+//	if err := gomek.JSONStatus(w, notice, http.StatusOK); err != nil {
+//		log.Println(err)
+//	}
+func JSONStatus(w http.ResponseWriter, schema interface{}, status int, opts ...JSONOption) error {
+	o := DefaultJSONOptions
+	if o.Indent == "" && debugJSON(w) {
+		o.Indent = "  "
+	}
+	for _, opt := range opts {
+		opt(&o)
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_, err = fmt.Fprintf(w, string(j))
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println(err)
-		return
+	jw := &jsonWriter{w: w, status: status, prefix: o.Prefix}
+	enc := json.NewEncoder(jw)
+	enc.SetEscapeHTML(o.EscapeHTML)
+	enc.SetIndent("", o.Indent)
+	err := enc.Encode(schema)
+	if err != nil && !jw.wroteHeader {
+		Problem(w, http.StatusInternalServerError, "", "", nil)
+	}
+	return err
+}
+
+// JSON encodes schema straight to w as JSON with the given status. Errors are
+// logged, use `JSONStatus` to handle them yourself.
+//
+//	gomek.JSON(w, notice, http.StatusOK)
+func JSON(w http.ResponseWriter, schema interface{}, status int, opts ...JSONOption) {
+	if err := JSONStatus(w, schema, status, opts...); err != nil {
+		log.Println("[GOMEK] Error writing JSON response", err)
 	}
 }
@@ -1 +1,81 @@
 package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	JSON(w, map[string]string{"discount": "100%d off"}, http.StatusCreated)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected %d got %d", http.StatusCreated, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected application/json got %s", contentType)
+	}
+	expected := `{"discount":"100%d off"}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	w := httptest.NewRecorder()
+	JSON(w, map[string]string{"html": "<b>"}, http.StatusOK,
+		JSONIndent("  "),
+		JSONEscapeHTML(false),
+		JSONPrefix(JSON_SAFE_PREFIX),
+	)
+	expected := ")]}',\n{\n  \"html\": \"<b>\"\n}\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %q got %q", expected, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	JSON(w, map[string]string{"html": "<b>"}, http.StatusOK)
+	expected = `{"html":"\u003cb\u003e"}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+}
+
+func TestJSONStatusEncodingError(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := JSONStatus(w, map[string]interface{}{"ch": make(chan int)}, http.StatusOK)
+	if err == nil {
+		t.Errorf("Expected an encoding error")
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %d got %d", http.StatusInternalServerError, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != PROBLEM_CONTENT_TYPE {
+		t.Errorf("Expected %s got %s", PROBLEM_CONTENT_TYPE, contentType)
+	}
+}
+
+func TestJSONDebugPerApp(t *testing.T) {
+	view := func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "Joe"}, http.StatusOK)
+	}
+	debugApp := New(Config{Debug: true})
+	debugApp.Route("/").View(view).Methods("GET")
+	app := New(Config{})
+	app.Route("/").View(view).Methods("GET")
+	debugHandler := debugApp.setup().Handler
+	handler := app.setup().Handler
+
+	w := httptest.NewRecorder()
+	debugHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if expected := "{\n  \"name\": \"Joe\"\n}\n"; w.Body.String() != expected {
+		t.Errorf("Expected %q got %q", expected, w.Body.String())
+	}
+	// Another app in the same process isn't affected
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if expected := "{\"name\":\"Joe\"}\n"; w.Body.String() != expected {
+		t.Errorf("Expected %q got %q", expected, w.Body.String())
+	}
+}
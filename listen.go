@@ -0,0 +1,188 @@
+package gomek
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// First file descriptor passed by systemd socket activation, see sd_listen_fds(3)
+	listenFdsStart = 3
+)
+
+// systemdListener is a socket inherited through systemd socket activation
+type systemdListener struct {
+	name     string
+	listener net.Listener
+}
+
+var (
+	systemdOnce      sync.Once
+	systemdInherited []systemdListener
+	systemdErr       error
+)
+
+// loadSystemdListeners reads the sockets passed via `LISTEN_FDS` once per process.
+// The environment variables are unset so child processes don't inherit them.
+func loadSystemdListeners() ([]systemdListener, error) {
+	systemdOnce.Do(func() {
+		defer os.Unsetenv("LISTEN_PID")
+		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
+		if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+			return
+		}
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || count < 1 {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < count; i++ {
+			name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			f := os.NewFile(uintptr(listenFdsStart+i), name)
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				systemdErr = fmt.Errorf("systemd socket %s: %w", name, err)
+				return
+			}
+			systemdInherited = append(systemdInherited, systemdListener{name: name, listener: l})
+		}
+	})
+	return systemdInherited, systemdErr
+}
+
+// SystemdListeners returns the listeners passed to the process by systemd socket
+// activation, in file descriptor order. Returns an empty slice if the process was
+// not socket activated.
+//
+//	listeners, err := gomek.SystemdListeners()
+//	if err == nil && len(listeners) > 0 {
+//		app.Serve(listeners[0])
+//	}
+func SystemdListeners() ([]net.Listener, error) {
+	inherited, err := loadSystemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for _, s := range inherited {
+		listeners = append(listeners, s.listener)
+	}
+	return listeners, nil
+}
+
+// listen opens a listener for an address passed to `ListenAddr`
+func listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		// Remove a stale socket left behind by a previous process
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		name := strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":")
+		inherited, err := loadSystemdListeners()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range inherited {
+			if name == "" || s.name == name {
+				return s.listener, nil
+			}
+		}
+		return nil, fmt.Errorf("no systemd socket named %q", name)
+	default:
+		return net.Listen("tcp", strings.TrimPrefix(addr, "tcp:"))
+	}
+}
+
+// openListeners returns the listeners the app will serve on. Listeners passed to
+// `Serve` are used as is, then each `ListenAddr` address is opened. If neither is
+// set the app listens on `Host:Port`.
+func (a *App) openListeners() ([]net.Listener, error) {
+	listeners := a.listeners
+	addrs := a.addrs
+	if len(listeners) == 0 && len(addrs) == 0 {
+		addrs = []string{createAddr(a)}
+	}
+	for _, addr := range addrs {
+		l, err := listen(addr)
+		if err != nil {
+			for _, opened := range listeners[len(a.listeners):] {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listenerURL(protocol string, l net.Listener) string {
+	if l.Addr().Network() == "unix" {
+		return fmt.Sprintf("%s+unix://%s", protocol, l.Addr())
+	}
+	return fmt.Sprintf("%s://%s", protocol, l.Addr())
+}
+
+// ListenAddr sets one or more addresses the server will accept requests on,
+// replacing `Host` & `Port`. Addresses are either `host:port`, `unix:<path>` for
+// a Unix socket or `systemd[:<name>]` for a socket passed by systemd socket activation.
+//
+//	app.ListenAddr("unix:/run/app.sock")
+//	app.ListenAddr("127.0.0.1:5000", "systemd:admin")
+func (a *App) ListenAddr(addrs ...string) {
+	a.addrs = addrs
+}
+
+// Serve sets up all the registered views & serves them on l. Like `Start` it
+// blocks until the server is shut down.
+//
+//	l, _ := net.Listen("tcp", "127.0.0.1:0")
+//	app.Serve(l)
+func (a *App) Serve(l net.Listener) error {
+	a.listeners = append(a.listeners, l)
+	return a.Start()
+}
+
+// RunAll runs several apps, each with its own routes & listeners, until ctx is
+// cancelled or the process receives a SIGINT or SIGTERM. If any app fails the
+// others are shut down. The first error is returned.
+//
+//	public := gomek.New(gomek.Config{})
+//	public.Listen(8080)
+//	admin := gomek.New(gomek.Config{})
+//	admin.ListenAddr("unix:/run/admin.sock")
+//	err := gomek.RunAll(context.Background(), public, admin)
+func RunAll(ctx context.Context, apps ...*App) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(apps))
+	for _, app := range apps {
+		go func(app *App) {
+			err := app.Run(ctx)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}(app)
+	}
+	var firstErr error
+	for range apps {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
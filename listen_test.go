@@ -0,0 +1,132 @@
+package gomek
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	var resp *http.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		resp, err = client.Get(url)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestApp_ServeListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	app := New(Config{})
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "Joe"}, http.StatusOK)
+	}).Methods("GET")
+	go app.Serve(l)
+	defer app.Shutdown()
+
+	_, body := get(t, http.DefaultClient, "http://"+l.Addr().String()+"/")
+	expected := `{"name":"Joe"}` + "\n"
+	if body != expected {
+		t.Errorf("Expected %s got '%v'", expected, body)
+	}
+}
+
+func TestApp_ServeListenerError(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	closed.Close()
+	addr := "127.0.0.1:" + strconv.Itoa(freePort(t))
+	app := New(Config{})
+	app.ListenAddr(addr)
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	if err := app.Serve(closed); err == nil {
+		t.Fatalf("Expected an error serving a closed listener")
+	}
+	// The other listeners are shut down
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("Expected %s to be closed", addr)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	public := New(Config{})
+	public.SetHost("127.0.0.1")
+	public.Listen(freePort(t))
+	public.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "public"}, http.StatusOK)
+	}).Methods("GET")
+	admin := New(Config{})
+	admin.ListenAddr("unix:" + socket)
+	admin.Route("/admin").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "admin"}, http.StatusOK)
+	}).Methods("GET")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- RunAll(ctx, public, admin)
+	}()
+
+	_, body := get(t, http.DefaultClient, "http://"+createAddr(public)+"/")
+	if expected := `{"name":"public"}` + "\n"; body != expected {
+		t.Errorf("Expected %s got '%v'", expected, body)
+	}
+	_, body = get(t, unixClient(socket), "http://unix/admin")
+	if expected := `{"name":"admin"}` + "\n"; body != expected {
+		t.Errorf("Expected %s got '%v'", expected, body)
+	}
+	status, _ := get(t, unixClient(socket), "http://unix/")
+	if status != http.StatusNotFound {
+		t.Errorf("Expected %d got %d", http.StatusNotFound, status)
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Errorf("Expected nil got %v", err)
+	}
+}
+
+func TestListenSystemdNotActivated(t *testing.T) {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		t.Errorf("Expected nil got %v", err)
+	}
+	if len(listeners) != 0 {
+		t.Errorf("Expected no listeners got %d", len(listeners))
+	}
+	if _, err := listen("systemd:admin"); err == nil {
+		t.Errorf("Expected an error for a missing systemd socket")
+	}
+}
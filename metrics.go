@@ -0,0 +1,424 @@
+package gomek
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Content type of the Prometheus text exposition format
+	METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+	// Route label of requests that didn't match a route
+	METRICS_UNMATCHED_ROUTE = "unmatched"
+	// Method label of requests with a non standard method
+	METRICS_OTHER_METHOD = "OTHER"
+)
+
+// DEFAULT_HISTOGRAM_BUCKETS are the upper bounds, in seconds, of latency histograms
+var DEFAULT_HISTOGRAM_BUCKETS = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// metric is a family of series written in the text exposition format
+type metric interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+// Registry holds metrics & writes them in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// NewRegistry creates an empty Registry. Most apps use `DefaultRegistry`.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// DefaultRegistry holds gomek's metrics, Go runtime stats & metrics created
+// with `NewCounter`, `NewGauge` & `NewHistogram`
+var DefaultRegistry = NewRegistry()
+
+func (reg *Registry) register(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	name := m.metricName()
+	if !metricNamePattern.MatchString(name) {
+		panic(fmt.Sprintf("gomek: invalid metric name %q", name))
+	}
+	if reg.names[name] {
+		panic(fmt.Sprintf("gomek: metric %q is already registered", name))
+	}
+	reg.names[name] = true
+	reg.metrics = append(reg.metrics, m)
+}
+
+// Write writes every metric in the Prometheus text exposition format
+func (reg *Registry) Write(w io.Writer) {
+	reg.mu.Lock()
+	metrics := append([]metric(nil), reg.metrics...)
+	reg.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// ServeHTTP exposes the registry's metrics to Prometheus
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", METRICS_CONTENT_TYPE)
+	reg.Write(w)
+}
+
+// MetricsView exposes `DefaultRegistry` as a gomek view
+//
+//	app.Route("/metrics").View(gomek.MetricsView).Methods("GET")
+func MetricsView(w http.ResponseWriter, r *http.Request, d *Data) {
+	DefaultRegistry.ServeHTTP(w, r)
+}
+
+// series is a single set of label values
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+// metricVec holds the series of a metric for each set of label values
+type metricVec struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*series
+}
+
+func newMetricVec(name, help, typ string, labels []string) *metricVec {
+	return &metricVec{name: name, help: help, typ: typ, labels: labels, series: map[string]*series{}}
+}
+
+func (v *metricVec) metricName() string {
+	return v.name
+}
+
+// with returns the series for labelValues, v.mu must be held
+func (v *metricVec) with(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("gomek: metric %s expects %d label values got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), labelValues...)}
+		if v.buckets != nil {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString formats label pairs, e.g. {route="/",method="GET"}
+func labelString(names []string, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelValueEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelValueEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.series) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	writeHeader(w, v.name, v.help, v.typ)
+	for _, key := range keys {
+		s := v.series[key]
+		if v.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labelString(v.labels, s.labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelString(v.labels, s.labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelString(v.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelString(v.labels, s.labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labelString(v.labels, s.labels), s.count)
+	}
+}
+
+// Counter is a metric that only goes up, e.g. the number of signups
+type Counter struct {
+	vec *metricVec
+}
+
+// NewCounter registers a counter with `DefaultRegistry`. Pass a value for each
+// label when counting.
+//
+//	signups := gomek.NewCounter("signups_total", "Number of signups.", "plan")
+//	signups.Inc("free")
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter with the registry
+func (reg *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newMetricVec(name, help, "counter", labels)}
+	reg.register(c.vec)
+	return c
+}
+
+// Inc adds 1 to the counter
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("gomek: counters can't decrease")
+	}
+	c.vec.mu.Lock()
+	c.vec.with(labelValues).value += v
+	c.vec.mu.Unlock()
+}
+
+// Gauge is a metric that can go up & down, e.g. the size of a queue
+type Gauge struct {
+	vec *metricVec
+}
+
+// NewGauge registers a gauge with `DefaultRegistry`
+//
+//	queued := gomek.NewGauge("jobs_queued", "Jobs waiting to run.")
+//	queued.Set(float64(len(jobs)))
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge with the registry
+func (reg *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newMetricVec(name, help, "gauge", labels)}
+	reg.register(g.vec)
+	return g
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.mu.Lock()
+	g.vec.with(labelValues).value = v
+	g.vec.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the gauge
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.vec.mu.Lock()
+	g.vec.with(labelValues).value += v
+	g.vec.mu.Unlock()
+}
+
+// Inc adds 1 to the gauge
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts 1 from the gauge
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations, e.g. durations, into buckets
+type Histogram struct {
+	vec *metricVec
+}
+
+// NewHistogram registers a histogram with `DefaultRegistry`. Pass nil buckets
+// for `DEFAULT_HISTOGRAM_BUCKETS`.
+//
+//	queries := gomek.NewHistogram("db_query_seconds", "Database query latency.", nil, "table")
+//	queries.Observe(time.Since(start).Seconds(), "notices")
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram with the registry
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DEFAULT_HISTOGRAM_BUCKETS
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{vec: newMetricVec(name, help, "histogram", labels)}
+	h.vec.buckets = buckets
+	reg.register(h.vec)
+	return h
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.mu.Lock()
+	defer h.vec.mu.Unlock()
+	s := h.vec.with(labelValues)
+	// Buckets are stored non-cumulatively & summed when written
+	i := sort.SearchFloat64s(h.vec.buckets, v)
+	if i < len(s.buckets) {
+		s.buckets[i]++
+	}
+	s.count++
+	s.value += v
+}
+
+// runtimeMetrics writes Go runtime stats when metrics are collected
+type runtimeMetrics struct{}
+
+func (runtimeMetrics) metricName() string {
+	return "go_goroutines"
+}
+
+func (runtimeMetrics) write(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	gauges := []struct {
+		name  string
+		help  string
+		typ   string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(stats.Alloc)},
+		{"go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(stats.HeapInuse)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge", float64(stats.Sys)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(stats.HeapObjects)},
+		{"go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(stats.NumGC)},
+		{"go_gc_pause_seconds_total", "Total GC pause time.", "counter", time.Duration(stats.PauseTotalNs).Seconds()},
+	}
+	for _, g := range gauges {
+		writeHeader(w, g.name, g.help, g.typ)
+		fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.value))
+	}
+	writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+	fmt.Fprintf(w, "go_info%s 1\n", labelString([]string{"version"}, []string{runtime.Version()}))
+}
+
+// gomek's own metrics
+var (
+	httpRequestsTotal = NewCounter("http_requests_total",
+		"Number of HTTP requests handled.", "route", "method", "status")
+	httpRequestDuration = NewHistogram("http_request_duration_seconds",
+		"HTTP request latency.", nil, "route", "method", "status")
+	httpRequestsInFlight = NewGauge("http_requests_in_flight",
+		"Number of HTTP requests being handled.", "route", "method")
+	templateRenderDuration = NewHistogram("gomek_template_render_seconds",
+		"Time taken to parse and execute a route's templates.", nil, "route")
+)
+
+func init() {
+	DefaultRegistry.register(runtimeMetrics{})
+}
+
+// RoutePattern returns the pattern of the route that matched the request, e.g.
+// "/blogs/<id>", or "" when no route matched
+func RoutePattern(r *http.Request) string {
+	route, _ := r.Context().Value(routeKey).(string)
+	return route
+}
+
+// routePatterns maps the Mux patterns of routes with path variables, e.g. "/blogs/",
+// to the route they were registered with, e.g. "/blogs/<id>"
+func (a *App) routePatterns() map[string]string {
+	patterns := map[string]string{}
+	for _, v := range a.view.StoredViews {
+		if v.registeredRoute != "" {
+			patterns[v.Route] = v.registeredRoute
+		}
+	}
+	return patterns
+}
+
+// metricsMethod returns the method label, clients can send any method so non
+// standard methods share a single series
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return METRICS_OTHER_METHOD
+}
+
+// Metrics records the number, latency & status of requests in `DefaultRegistry`,
+// labelled by route pattern rather than path so path variables don't create new
+// series. Non standard methods are labelled `METRICS_OTHER_METHOD`.
+//
+//	app.Use(gomek.Metrics())
+//	app.Route("/metrics").View(gomek.MetricsView).Methods("GET")
+func Metrics() func(next http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := RoutePattern(r)
+			if route == "" {
+				route = METRICS_UNMATCHED_ROUTE
+			}
+			method := metricsMethod(r.Method)
+			httpRequestsInFlight.Inc(route, method)
+			defer httpRequestsInFlight.Dec(route, method)
+			start := time.Now()
+			sw := newStatusWriter(w)
+			next.ServeHTTP(sw, r)
+			status := sw.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			code := strconv.Itoa(status)
+			httpRequestsTotal.Inc(route, method, code)
+			httpRequestDuration.Observe(time.Since(start).Seconds(), route, method, code)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package gomek
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	reg := NewRegistry()
+	signups := reg.NewCounter("signups_total", "Number of signups.", "plan")
+	queued := reg.NewGauge("jobs_queued", "Jobs waiting to run.")
+	latency := reg.NewHistogram("query_seconds", "Query latency.", []float64{0.1, 1})
+	signups.Inc("free")
+	signups.Add(2, `say "hi"`)
+	queued.Set(3)
+	queued.Dec()
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var out bytes.Buffer
+	reg.Write(&out)
+	expected := `# HELP signups_total Number of signups.
+# TYPE signups_total counter
+signups_total{plan="free"} 1
+signups_total{plan="say \"hi\""} 2
+# HELP jobs_queued Jobs waiting to run.
+# TYPE jobs_queued gauge
+jobs_queued 2
+# HELP query_seconds Query latency.
+# TYPE query_seconds histogram
+query_seconds_bucket{le="0.1"} 1
+query_seconds_bucket{le="1"} 2
+query_seconds_bucket{le="+Inf"} 3
+query_seconds_sum 5.55
+query_seconds_count 3
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestRegistryDuplicateName(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("signups_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic registering a metric twice")
+		}
+	}()
+	reg.NewGauge("signups_total", "")
+}
+
+// resetMetrics clears gomek's own metrics so tests can be run more than once
+func resetMetrics() {
+	for _, vec := range []*metricVec{httpRequestsTotal.vec, httpRequestDuration.vec, httpRequestsInFlight.vec, templateRenderDuration.vec} {
+		vec.mu.Lock()
+		vec.series = map[string]*series{}
+		vec.mu.Unlock()
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	resetMetrics()
+	layout := filepath.Join(t.TempDir(), "layout.gohtml")
+	if err := os.WriteFile(layout, []byte(`{{ define "layout" }}{{ .id }}{{ end }}`), 0600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	app := New(Config{})
+	app.Use(Metrics())
+	app.Route("/metrics").View(MetricsView).Methods("GET")
+	app.Route("/notices/<id>").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		*d = Data{"id": Args(r)["id"]}
+	}).Methods("GET").Templates(layout)
+	handler := app.setup().Handler
+
+	for _, target := range []string{"/notices/1", "/notices/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	for _, method := range []string{"FOO", "BAR"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/notices/1", nil))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := w.Header().Get("Content-Type"); contentType != METRICS_CONTENT_TYPE {
+		t.Errorf("expected %s got %s", METRICS_CONTENT_TYPE, contentType)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`http_requests_total{route="/notices/<id>",method="GET",status="200"} 2`,
+		`http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`http_requests_total{route="/notices/<id>",method="OTHER",status="405"} 2`,
+		`http_request_duration_seconds_count{route="/notices/<id>",method="GET",status="200"} 2`,
+		`http_requests_in_flight{route="/metrics",method="GET"} 1`,
+		`gomek_template_render_seconds_count{route="/notices/<id>"} 2`,
+		"# TYPE go_goroutines gauge",
+		"go_memstats_alloc_bytes ",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %s in\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `route="/notices/1"`) || strings.Contains(body, `method="FOO"`) {
+		t.Errorf("expected requests to be labelled by route pattern got\n%s", body)
+	}
+}
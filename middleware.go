@@ -3,7 +3,6 @@ package gomek
 import (
 	"context"
 	"fmt"
-	"github.com/joegasewicz/status-writer"
 	"net/http"
 	"strings"
 	"time"
@@ -18,10 +17,14 @@ func Logging(next http.Handler) http.HandlerFunc {
 		duration := time.Duration(time.Now().Sub(start)) * time.Nanosecond
 
 		// Set status
-		sw := status_writer.New(w)
+		sw := newStatusWriter(w)
 		next.ServeHTTP(sw, r)
 		statusCode := sw.Status
-		msg := fmt.Sprintf("[INFO] %s %s %ds Status: %d\n", r.Method, r.RequestURI, duration, statusCode)
+		msg := fmt.Sprintf("[INFO] %s %s %s %ds Status: %d", ClientIP(r), r.Method, r.RequestURI, duration, statusCode)
+		if traceID := responseTraceID(w); traceID != "" {
+			msg += " Trace: " + traceID
+		}
+		msg += "\n"
 
 		if statusCode < 400 {
 			out = PrintWithColor(msg, BLUE)
@@ -38,6 +41,31 @@ func setHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Methods", "*")
 }
 
+// HSTS sets the `Strict-Transport-Security` header on responses to HTTPS requests.
+// Browsers ignore the header over plain HTTP so it is only sent when the request used TLS,
+// or a trusted proxy forwarded an HTTPS request.
+//
+//	app.Use(gomek.HSTS(365*24*time.Hour, true))
+func HSTS(maxAge time.Duration, includeSubDomains bool) func(next http.Handler) http.HandlerFunc {
+	value := hstsValue(maxAge, includeSubDomains)
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requestClient(r).Scheme == "https" {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hstsValue(maxAge time.Duration, includeSubDomains bool) string {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if includeSubDomains {
+		value += "; includeSubDomains"
+	}
+	return value
+}
+
 // CORS basic development cors
 func CORS(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -114,6 +142,9 @@ func allowRoute(routes [][]string, currentRoute string, reqMethod string) bool {
 //				ctx := context.WithValue(r.Context(), "userID", 1)
 //				return true, ctx
 //			}))
+//
+//	Use `gomek.ClientIP(r)` in the callback for the client's address, it is resolved through
+//	`Config.TrustedProxies` before any middleware runs.
 func Authorize(whiteList [][]string, callback func(r *http.Request) (bool, context.Context)) func(next http.Handler) http.HandlerFunc {
 	inner := func(next http.Handler) http.HandlerFunc {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -123,7 +154,7 @@ func Authorize(whiteList [][]string, callback func(r *http.Request) (bool, conte
 				// This route is not whitelisted so perform test from callback
 				ok, ctx = callback(r)
 				if !ok {
-					w.WriteHeader(http.StatusUnauthorized)
+					httpError(w, r, http.StatusUnauthorized, "")
 					return
 				}
 				if ctx != nil {
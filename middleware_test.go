@@ -1,6 +1,13 @@
 package gomek
 
-import "testing"
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
 
 func TestLogging(t *testing.T) {
 
@@ -9,3 +16,40 @@ func TestLogging(t *testing.T) {
 func TestAuthorize(t *testing.T) {
 
 }
+
+func TestHSTS(t *testing.T) {
+	handler := HSTS(24*time.Hour, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if value := w.Header().Get("Strict-Transport-Security"); value != "" {
+		t.Errorf("expected no header over plain HTTP got %s", value)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	handler(w, req)
+	expected := "max-age=86400; includeSubDomains"
+	if value := w.Header().Get("Strict-Transport-Security"); value != expected {
+		t.Errorf("expected %s got %s", expected, value)
+	}
+}
+
+func TestAuthorizeUnauthorizedProblem(t *testing.T) {
+	whiteList := [][]string{{"/", "GET"}}
+	handler := Authorize(whiteList, func(r *http.Request) (bool, context.Context) {
+		return false, nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d got %d", http.StatusUnauthorized, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != PROBLEM_CONTENT_TYPE {
+		t.Errorf("expected %s got %s", PROBLEM_CONTENT_TYPE, contentType)
+	}
+}
@@ -0,0 +1,281 @@
+package gomek
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// msgpackWriter encodes values in the MessagePack format, see
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+type msgpackWriter struct {
+	buf bytes.Buffer
+}
+
+// MarshalMsgpack returns the MessagePack encoding of v. Structs are encoded as
+// maps keyed by their `msgpack` tag, falling back to the `json` tag & then the
+// field name. `time.Time` values use the timestamp extension type.
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	var m msgpackWriter
+	if err := m.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return m.buf.Bytes(), nil
+}
+
+func (m *msgpackWriter) write(b ...byte) {
+	m.buf.Write(b)
+}
+
+func (m *msgpackWriter) writeUint(prefix byte, n uint64, size int) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	m.write(prefix)
+	m.write(b[8-size:]...)
+}
+
+func (m *msgpackWriter) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		m.encodeUint(uint64(n))
+	case n >= -32:
+		m.write(byte(n))
+	case n >= math.MinInt8:
+		m.writeUint(0xd0, uint64(n), 1)
+	case n >= math.MinInt16:
+		m.writeUint(0xd1, uint64(n), 2)
+	case n >= math.MinInt32:
+		m.writeUint(0xd2, uint64(n), 4)
+	default:
+		m.writeUint(0xd3, uint64(n), 8)
+	}
+}
+
+func (m *msgpackWriter) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		m.write(byte(n))
+	case n <= math.MaxUint8:
+		m.writeUint(0xcc, n, 1)
+	case n <= math.MaxUint16:
+		m.writeUint(0xcd, n, 2)
+	case n <= math.MaxUint32:
+		m.writeUint(0xce, n, 4)
+	default:
+		m.writeUint(0xcf, n, 8)
+	}
+}
+
+func (m *msgpackWriter) encodeString(s string) {
+	n := uint64(len(s))
+	switch {
+	case n <= 31:
+		m.write(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		m.writeUint(0xd9, n, 1)
+	case n <= math.MaxUint16:
+		m.writeUint(0xda, n, 2)
+	default:
+		m.writeUint(0xdb, n, 4)
+	}
+	m.buf.WriteString(s)
+}
+
+func (m *msgpackWriter) encodeBinary(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		m.writeUint(0xc4, n, 1)
+	case n <= math.MaxUint16:
+		m.writeUint(0xc5, n, 2)
+	default:
+		m.writeUint(0xc6, n, 4)
+	}
+	m.buf.Write(b)
+}
+
+func (m *msgpackWriter) encodeArrayHeader(n int) {
+	switch {
+	case n <= 15:
+		m.write(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		m.writeUint(0xdc, uint64(n), 2)
+	default:
+		m.writeUint(0xdd, uint64(n), 4)
+	}
+}
+
+func (m *msgpackWriter) encodeMapHeader(n int) {
+	switch {
+	case n <= 15:
+		m.write(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		m.writeUint(0xde, uint64(n), 2)
+	default:
+		m.writeUint(0xdf, uint64(n), 4)
+	}
+}
+
+// encodeTime writes the timestamp extension type (-1) in its 96 bit format
+func (m *msgpackWriter) encodeTime(t time.Time) {
+	m.write(0xc7, 12, 0xff)
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b, uint32(t.Nanosecond()))
+	binary.BigEndian.PutUint64(b[4:], uint64(t.Unix()))
+	m.buf.Write(b)
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (m *msgpackWriter) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		m.write(0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		m.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+	if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		m.encodeString(string(text))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			m.write(0xc0)
+			return nil
+		}
+		return m.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			m.write(0xc3)
+		} else {
+			m.write(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		m.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		m.encodeUint(v.Uint())
+	case reflect.Float32:
+		m.writeUint(0xca, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		m.writeUint(0xcb, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		m.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			m.write(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			m.encodeBinary(b)
+			return nil
+		}
+		m.encodeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := m.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			m.write(0xc0)
+			return nil
+		}
+		keys := v.MapKeys()
+		// Sort keys so the output is deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		m.encodeMapHeader(len(keys))
+		for _, k := range keys {
+			if err := m.encode(k); err != nil {
+				return err
+			}
+			if err := m.encode(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return m.encodeStruct(v)
+	default:
+		return fmt.Errorf("%w: msgpack: unsupported type %s", ErrUnsupportedValue, v.Type())
+	}
+	return nil
+}
+
+func (m *msgpackWriter) encodeStruct(v reflect.Value) error {
+	type field struct {
+		name  string
+		value reflect.Value
+	}
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("msgpack")
+		if tag == "" {
+			tag = f.Tag.Get("json")
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		omitEmpty := false
+		for _, option := range parts[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		fields = append(fields, field{name: name, value: fv})
+	}
+	m.encodeMapHeader(len(fields))
+	for _, f := range fields {
+		m.encodeString(f.name)
+		if err := m.encode(f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	b, err := MarshalMsgpack(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
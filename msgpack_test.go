@@ -0,0 +1,44 @@
+package gomek
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMarshalMsgpack(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{7, []byte{0x07}},
+		{-1, []byte{0xff}},
+		{-100, []byte{0xd0, 0x9c}},
+		{300, []byte{0xcd, 0x01, 0x2c}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"Joe", []byte{0xa3, 'J', 'o', 'e'}},
+		{[]byte{1, 2}, []byte{0xc4, 0x02, 0x01, 0x02}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{testRow{Name: "Jo", Count: 1}, []byte{0x82, 0xa4, 'n', 'a', 'm', 'e', 0xa2, 'J', 'o', 0xa5, 'c', 'o', 'u', 'n', 't', 0x01}},
+		{time.Unix(1, 2), []byte{0xc7, 12, 0xff, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, test := range tests {
+		b, err := MarshalMsgpack(test.value)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !bytes.Equal(b, test.expected) {
+			t.Errorf("%v: expected % x got % x", test.value, test.expected, b)
+		}
+	}
+}
+
+func TestMarshalMsgpackUnsupported(t *testing.T) {
+	if _, err := MarshalMsgpack(make(chan int)); !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("Expected %v for a channel got %v", ErrUnsupportedValue, err)
+	}
+}
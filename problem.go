@@ -0,0 +1,119 @@
+package gomek
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+// Problem writes an RFC 7807 `application/problem+json` response. An empty title
+// defaults to the status text. Extensions are added as extra members of the
+// problem object. Traced requests also get a "traceId" member.
+//
+//	gomek.Problem(w, http.StatusConflict, "", "notice 1 already exists", map[string]interface{}{
+//		"notice_id": 1,
+//	})
+func Problem(w http.ResponseWriter, status int, title string, detail string, extensions map[string]interface{}) {
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	problem := map[string]interface{}{}
+	for k, v := range extensions {
+		problem[k] = v
+	}
+	problem["type"] = "about:blank"
+	problem["title"] = title
+	problem["status"] = status
+	if detail != "" {
+		problem["detail"] = detail
+	}
+	if t, ok := extensions["type"]; ok {
+		problem["type"] = t
+	}
+	if instance, ok := extensions["instance"]; ok {
+		problem["instance"] = instance
+	}
+	if _, ok := problem["traceId"]; !ok {
+		if traceID := responseTraceID(w); traceID != "" {
+			problem["traceId"] = traceID
+		}
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		log.Println("[GOMEK] Error encoding problem", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Error writes err as a problem response with a status matching the error:
+//
+//	*ValidationError    422, with the field errors in an "errors" member
+//	ErrBodyTooLarge     413
+//	ErrInvalidBody      400
+//	anything else       500, the error is logged but not sent to the client
+//
+// For example, after binding a request body
+//
+//	var user NewUser
+//	if err := gomek.BindJSON(r, &user); err != nil {
+//		gomek.Error(w, err)
+//		return
+//	}
+func Error(w http.ResponseWriter, err error) {
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &verr):
+		Problem(w, http.StatusUnprocessableEntity, "", "the request contains invalid fields", map[string]interface{}{
+			"errors": verr.Errors,
+		})
+	case errors.Is(err, ErrBodyTooLarge):
+		Problem(w, http.StatusRequestEntityTooLarge, "", err.Error(), nil)
+	case errors.Is(err, ErrUnsupportedMediaType):
+		Problem(w, http.StatusUnsupportedMediaType, "", err.Error(), nil)
+	case errors.Is(err, http.ErrMissingFile):
+		Problem(w, http.StatusBadRequest, "", err.Error(), nil)
+	case errors.Is(err, ErrInvalidBody):
+		Problem(w, http.StatusBadRequest, "", err.Error(), nil)
+	default:
+		if traceID := responseTraceID(w); traceID != "" {
+			log.Println("[GOMEK] Error:", err, "Trace:", traceID)
+		} else {
+			log.Println("[GOMEK] Error:", err)
+		}
+		Problem(w, http.StatusInternalServerError, "", "", nil)
+	}
+}
+
+// acceptsHTML reports whether the client prefers an HTML response, e.g. a browser
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") && !strings.Contains(accept, "json")
+}
+
+// httpError writes gomek's own error responses, problem+json for API clients &
+// plain text for browsers
+func httpError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if acceptsHTML(r) {
+		text := http.StatusText(status)
+		if traceID := responseTraceID(w); traceID != "" {
+			text += "\nTrace ID: " + traceID
+		}
+		http.Error(w, text, status)
+		return
+	}
+	Problem(w, status, "", detail, nil)
+}
+
+// notFound is served for requests that don't match any registered route
+func notFound(w http.ResponseWriter, r *http.Request) {
+	httpError(w, r, http.StatusNotFound, "no route matches "+r.URL.Path)
+}
@@ -0,0 +1,104 @@
+package gomek
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	if contentType := w.Header().Get("Content-Type"); contentType != PROBLEM_CONTENT_TYPE {
+		t.Errorf("Expected %s got %s", PROBLEM_CONTENT_TYPE, contentType)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return problem
+}
+
+func TestProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	Problem(w, http.StatusConflict, "", "notice 1 already exists", map[string]interface{}{
+		"notice_id": 1,
+		"instance":  "/notices/1",
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected %d got %d", http.StatusConflict, w.Code)
+	}
+	problem := decodeProblem(t, w)
+	expected := map[string]interface{}{
+		"type":      "about:blank",
+		"title":     "Conflict",
+		"status":    float64(http.StatusConflict),
+		"detail":    "notice 1 already exists",
+		"instance":  "/notices/1",
+		"notice_id": float64(1),
+	}
+	for k, v := range expected {
+		if problem[k] != v {
+			t.Errorf("Expected %s to be %v got %v", k, v, problem[k])
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{&ValidationError{Errors: []FieldError{{Field: "name", Rule: "required", Message: "is required"}}}, http.StatusUnprocessableEntity},
+		{ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: unexpected EOF", ErrInvalidBody), http.StatusBadRequest},
+		{fmt.Errorf("database down"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		Error(w, test.err)
+		if w.Code != test.status {
+			t.Errorf("Expected %d got %d", test.status, w.Code)
+		}
+		problem := decodeProblem(t, w)
+		if test.status == http.StatusInternalServerError && problem["detail"] != nil {
+			t.Errorf("Expected internal errors not to be exposed got %v", problem["detail"])
+		}
+		if test.status == http.StatusUnprocessableEntity && problem["errors"] == nil {
+			t.Errorf("Expected field errors got %v", problem)
+		}
+	}
+}
+
+func TestProblemNotFoundAndMethodNotAllowed(t *testing.T) {
+	app := New(Config{})
+	app.Route("/notices").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	handler := app.setup().Handler
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d got %d", http.StatusNotFound, w.Code)
+	}
+	decodeProblem(t, w)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/notices", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf("Expected GET, OPTIONS got %s", allow)
+	}
+	decodeProblem(t, w)
+
+	// Browsers get plain text
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text/plain got %s", w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,281 @@
+package gomek
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TRUSTED_PROXY_UNIX in `Config.TrustedProxies` trusts peers connected over a Unix socket
+const TRUSTED_PROXY_UNIX = "unix"
+
+// client is the request's resolved client address, scheme & host
+type client struct {
+	IP     string
+	Scheme string
+	Host   string
+}
+
+// parseNetworks parses CIDRs & single IP addresses, e.g. "10.0.0.0/8" or "::1"
+func parseNetworks(addrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", addr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", addr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ipInNetworks reports whether ip is in any of nets
+func ipInNetworks(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func trusted(nets []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ipInNetworks(nets, ip)
+}
+
+// proxySet is the parsed `Config.TrustedProxies`
+type proxySet struct {
+	nets []*net.IPNet
+	// unix trusts Unix socket peers, they have no IP address to match
+	unix bool
+}
+
+// parseProxies parses CIDRs, IP addresses & `TRUSTED_PROXY_UNIX`
+func parseProxies(addrs []string) (proxySet, error) {
+	var proxies proxySet
+	var networks []string
+	for _, addr := range addrs {
+		if strings.TrimSpace(addr) == TRUSTED_PROXY_UNIX {
+			proxies.unix = true
+			continue
+		}
+		networks = append(networks, addr)
+	}
+	nets, err := parseNetworks(networks)
+	proxies.nets = nets
+	return proxies, err
+}
+
+// unixPeer reports whether the request arrived on a Unix socket
+func unixPeer(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// remoteIP returns the IP address of the connection's peer. Unix socket peers
+// have none, "" is returned.
+func remoteIP(r *http.Request) string {
+	if unixPeer(r) {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedElement is a single hop of an RFC 7239 Forwarded header
+type forwardedElement struct {
+	For   string
+	Proto string
+	Host  string
+}
+
+// parseForwarded parses the hops of every Forwarded header, client first
+func parseForwarded(values []string) []forwardedElement {
+	var elements []forwardedElement
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var e forwardedElement
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(name) {
+				case "for":
+					e.For = forwardedIP(value)
+				case "proto":
+					e.Proto = strings.ToLower(value)
+				case "host":
+					e.Host = value
+				}
+			}
+			elements = append(elements, e)
+		}
+	}
+	return elements
+}
+
+// forwardedIP strips the port & brackets from a Forwarded for value, e.g.
+// "[2001:db8::1]:4711". Obfuscated identifiers such as "unknown" return "".
+func forwardedIP(value string) string {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.Trim(value, "[]")
+	if net.ParseIP(value) == nil {
+		return ""
+	}
+	return value
+}
+
+// splitHeader returns the comma separated values of every header called name
+func splitHeader(h http.Header, name string) []string {
+	var values []string
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+	return values
+}
+
+// hopValue returns the value recorded pos hops back from the nearest proxy.
+// Proxies that overwrite the header rather than append leave fewer values, the
+// leftmost is then used.
+func hopValue(values []string, pos int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	i := len(values) - 1 - pos
+	if i < 0 {
+		i = 0
+	}
+	return values[i]
+}
+
+// resolveClient works out the client's address, scheme & host. Forwarding
+// headers are only read from trusted proxies, hops are walked from the nearest
+// proxy back until an untrusted address, which is the client. The scheme & host
+// are read from the same hop, values to its left were sent by the client.
+func resolveClient(r *http.Request, proxies proxySet) client {
+	c := client{IP: remoteIP(r), Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		c.Scheme = "https"
+	}
+	if !trusted(proxies.nets, c.IP) && !(proxies.unix && unixPeer(r)) {
+		return c
+	}
+	if elements := parseForwarded(r.Header.Values("Forwarded")); len(elements) > 0 {
+		i := len(elements) - 1
+		for i > 0 && trusted(proxies.nets, elements[i].For) {
+			i--
+		}
+		if elements[i].For != "" {
+			c.IP = elements[i].For
+		}
+		// The client facing proxy recorded the original scheme & host
+		if elements[i].Proto == "http" || elements[i].Proto == "https" {
+			c.Scheme = elements[i].Proto
+		}
+		if elements[i].Host != "" {
+			c.Host = elements[i].Host
+		}
+		return c
+	}
+	// pos counts the hops between the nearest & the client facing proxy
+	pos := 0
+	if hops := splitHeader(r.Header, "X-Forwarded-For"); len(hops) > 0 {
+		i := len(hops) - 1
+		for i > 0 && trusted(proxies.nets, hops[i]) {
+			i--
+		}
+		if ip := forwardedIP(hops[i]); ip != "" {
+			c.IP = ip
+		}
+		pos = len(hops) - 1 - i
+	} else if ip := forwardedIP(r.Header.Get("X-Real-IP")); ip != "" {
+		c.IP = ip
+	}
+	if proto := strings.ToLower(hopValue(splitHeader(r.Header, "X-Forwarded-Proto"), pos)); proto == "http" || proto == "https" {
+		c.Scheme = proto
+	}
+	if host := hopValue(splitHeader(r.Header, "X-Forwarded-Host"), pos); host != "" {
+		c.Host = host
+	}
+	return c
+}
+
+// setClient resolves the request's client & sets r.Host to the original host
+func setClient(r *http.Request, proxies proxySet) *http.Request {
+	c := resolveClient(r, proxies)
+	ctx := context.WithValue(r.Context(), clientKey, c)
+	r = r.WithContext(ctx)
+	r.Host = c.Host
+	return r
+}
+
+// trustedProxies parses `Config.TrustedProxies`
+func (a *App) trustedProxies() proxySet {
+	proxies, err := parseProxies(a.Config.TrustedProxies)
+	if err != nil {
+		out := fmt.Sprintf("[GOMEK]: Error parsing TrustedProxies: %v", err)
+		log.Fatalf(PrintWithColor(out, RED))
+	}
+	return proxies
+}
+
+func requestClient(r *http.Request) client {
+	if c, ok := r.Context().Value(clientKey).(client); ok {
+		return c
+	}
+	c := client{IP: remoteIP(r), Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		c.Scheme = "https"
+	}
+	return c
+}
+
+// ClientIP returns the client's IP address. Behind a proxy listed in
+// `Config.TrustedProxies` it is read from the `Forwarded`, `X-Forwarded-For` or
+// `X-Real-IP` headers, otherwise it is the connection's address. Unix socket peers
+// have no address, add `TRUSTED_PROXY_UNIX` to read it from the proxy's headers.
+//
+//	app := gomek.New(gomek.Config{TrustedProxies: []string{"10.0.0.0/8"}})
+//	ip := gomek.ClientIP(r)
+func ClientIP(r *http.Request) string {
+	return requestClient(r).IP
+}
+
+// RequestURL returns the absolute URL the client requested, using the scheme &
+// host forwarded by trusted proxies
+//
+//	next := gomek.RequestURL(r).String() // https://example.com/notices?page=2
+func RequestURL(r *http.Request) *url.URL {
+	c := requestClient(r)
+	u := *r.URL
+	u.Scheme = c.Scheme
+	u.Host = c.Host
+	return &u
+}
@@ -0,0 +1,196 @@
+package gomek
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseProxies([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		expected   string
+	}{
+		{"direct", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"untrusted peer", "203.0.113.9:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.9"},
+		{"x-forwarded-for", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "1.2.3.4"},
+		{"spoofed hops", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.2.3.4, 10.0.0.2"}}, "1.2.3.4"},
+		{"multiple headers", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6", "1.2.3.4"}}, "1.2.3.4"},
+		{"all trusted", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"x-real-ip", "192.168.1.1:1234", http.Header{"X-Real-Ip": {"1.2.3.4"}}, "1.2.3.4"},
+		{"forwarded", "10.0.0.1:1234", http.Header{"Forwarded": {`for=6.6.6.6, for="[2001:db9::1]:4711";proto=https, for=10.0.0.2`}}, "2001:db9::1"},
+		{"forwarded unknown", "10.0.0.1:1234", http.Header{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8::5]:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "1.2.3.4"},
+		{"invalid header", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"not-an-ip"}}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		if ip := ClientIP(setClient(req, proxies)); ip != tt.expected {
+			t.Errorf("%s: expected %s got %s", tt.name, tt.expected, ip)
+		}
+	}
+	if _, err := parseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected an invalid CIDR to error")
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	app := New(Config{TrustedProxies: []string{"10.0.0.0/8"}})
+	var url, host, ip string
+	app.Route("/notices").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		url, host, ip = RequestURL(r).String(), r.Host, ClientIP(r)
+	}).Methods("GET")
+	app.Use(HSTS(60, false))
+	handler := app.setup().Handler
+
+	req := httptest.NewRequest("GET", "http://internal:5000/notices?page=2", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if url != "https://example.com/notices?page=2" || host != "example.com" || ip != "1.2.3.4" {
+		t.Errorf("Expected the forwarded URL got %s %s %s", url, host, ip)
+	}
+	if w.Header().Get("Strict-Transport-Security") == "" {
+		t.Errorf("Expected HSTS for a forwarded HTTPS request")
+	}
+
+	// Untrusted peers can't change the scheme or host
+	req = httptest.NewRequest("GET", "http://internal:5000/notices", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("Forwarded", "host=evil.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if url != "http://internal:5000/notices" || w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("Expected the original URL got %s %v", url, w.Header())
+	}
+
+	req = httptest.NewRequest("GET", "https://secure/notices", nil)
+	req.TLS = &tls.ConnectionState{}
+	if u := RequestURL(req).String(); u != "https://secure/notices" {
+		t.Errorf("Expected https://secure/notices got %s", u)
+	}
+}
+
+func TestForwardedSchemeAndHost(t *testing.T) {
+	proxies, _ := parseProxies([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name   string
+		header http.Header
+		scheme string
+		host   string
+	}{
+		{"forwarded spoofed hop", http.Header{"Forwarded": {"for=1.2.3.4;host=evil.example;proto=https, for=5.6.7.8;host=real.example;proto=http"}}, "http", "real.example"},
+		{"forwarded through proxies", http.Header{"Forwarded": {"for=5.6.7.8;host=real.example;proto=https, for=10.0.0.2;host=internal;proto=http"}}, "https", "real.example"},
+		{"x-forwarded spoofed hop", http.Header{
+			"X-Forwarded-For":   {"1.2.3.4, 5.6.7.8"},
+			"X-Forwarded-Proto": {"https, http"},
+			"X-Forwarded-Host":  {"evil.example, real.example"},
+		}, "http", "real.example"},
+		{"x-forwarded through proxies", http.Header{
+			"X-Forwarded-For":   {"5.6.7.8, 10.0.0.2"},
+			"X-Forwarded-Proto": {"https, http"},
+			"X-Forwarded-Host":  {"real.example, internal"},
+		}, "https", "real.example"},
+		{"x-forwarded overwritten", http.Header{
+			"X-Forwarded-For":   {"5.6.7.8, 10.0.0.2"},
+			"X-Forwarded-Proto": {"https"},
+			"X-Forwarded-Host":  {"real.example"},
+		}, "https", "real.example"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://internal/x", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		req = setClient(req, proxies)
+		if expected := tt.scheme + "://" + tt.host + "/x"; RequestURL(req).String() != expected || req.Host != tt.host {
+			t.Errorf("%s: expected %s got %s %s", tt.name, expected, RequestURL(req), req.Host)
+		}
+	}
+}
+
+func TestUnixSocketProxy(t *testing.T) {
+	unixGet := func(t *testing.T, proxies []string, forwardedFor string) (int, string) {
+		l, err := net.Listen("unix", filepath.Join(t.TempDir(), "app.sock"))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		app := New(Config{TrustedProxies: proxies})
+		app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+			w.Write([]byte(RateLimitByIP(r)))
+		}).Methods("GET")
+		app.Use(IPFilter(nil, []string{"6.6.6.6"}))
+		go app.Serve(l)
+		defer app.Shutdown()
+
+		req, _ := http.NewRequest("GET", "http://unix/", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		client := unixClient(l.Addr().String())
+		var resp *http.Response
+		for i := 0; i < 100; i++ {
+			if resp, err = client.Do(req); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := unixGet(t, []string{TRUSTED_PROXY_UNIX}, "1.2.3.4"); status != http.StatusOK || body != "ip:1.2.3.4" {
+		t.Errorf("Expected the forwarded client got %d %s", status, body)
+	}
+	if status, _ := unixGet(t, []string{TRUSTED_PROXY_UNIX}, "6.6.6.6"); status != http.StatusForbidden {
+		t.Errorf("Expected the forwarded client to be denied got %d", status)
+	}
+	// Without TRUSTED_PROXY_UNIX the headers are ignored & the peer has no address
+	if status, _ := unixGet(t, []string{"10.0.0.0/8"}, "1.2.3.4"); status != http.StatusForbidden {
+		t.Errorf("Expected an untrusted Unix socket peer to be denied got %d", status)
+	}
+}
+
+func TestClientIPAppContextValue(t *testing.T) {
+	app := New(Config{TrustedProxies: []string{"10.0.0.0/8"}})
+	var ip string
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		ip = ClientIP(r)
+	}).Methods("GET")
+	// The app's own "client" value doesn't replace gomek's
+	app.Use(func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "client", "acme")))
+		}
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	app.setup().Handler.ServeHTTP(httptest.NewRecorder(), req)
+	if ip != "1.2.3.4" {
+		t.Errorf("Expected 1.2.3.4 got %s", ip)
+	}
+}
@@ -0,0 +1,288 @@
+package gomek
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitAlgorithm selects how requests are counted
+type RateLimitAlgorithm int
+
+const (
+	// TOKEN_BUCKET refills Limit tokens every Window & allows bursts of up to Burst requests
+	TOKEN_BUCKET RateLimitAlgorithm = iota
+	// SLIDING_WINDOW allows Limit requests in any Window, weighting the previous window
+	SLIDING_WINDOW
+)
+
+const (
+	// How often the in-memory store removes idle keys
+	DEFAULT_RATE_LIMIT_SWEEP = time.Minute
+)
+
+// RateLimitPolicy is the limit a `RateLimitStore` enforces for a key
+type RateLimitPolicy struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+	Burst     int
+}
+
+// RateLimitResult is the outcome of a single request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the limit is fully restored
+	Reset time.Duration
+	// RetryAfter is how long to wait before retrying a rejected request
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests for each key. Implement it to share limits
+// between instances, e.g. with Redis.
+type RateLimitStore interface {
+	// Take records a request for key & reports whether it is within policy
+	Take(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitOptions configures `RateLimit`
+type RateLimitOptions struct {
+	// Limit requests are allowed every Window
+	Limit  int
+	Window time.Duration
+	// Algorithm defaults to `TOKEN_BUCKET`
+	Algorithm RateLimitAlgorithm
+	// Burst is the token bucket's capacity, defaults to Limit
+	Burst int
+	// Key identifies the client, defaults to `RateLimitByIP`
+	Key func(r *http.Request) string
+	// Group shares a limit between every route that uses the same group. By
+	// default each route or middleware has its own limit.
+	Group string
+	// Store defaults to an in-memory store
+	Store RateLimitStore
+}
+
+// RateLimitByIP keys requests by the client's IP address, see `ClientIP`
+func RateLimitByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// RateLimitByHeader keys requests by a header such as an API key, falling back
+// to the client's IP address when it is missing
+//
+//	gomek.RateLimitOptions{Limit: 1000, Window: time.Hour, Key: gomek.RateLimitByHeader("X-API-Key")}
+func RateLimitByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return name + ":" + value
+		}
+		return RateLimitByIP(r)
+	}
+}
+
+// RateLimitByContext keys requests by a value in the request context, such as
+// the user ID added by an `Authorize` callback, falling back to the client's IP
+// address when it is missing
+//
+//	gomek.RateLimitOptions{Limit: 100, Window: time.Minute, Key: gomek.RateLimitByContext("userID")}
+func RateLimitByContext(key string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if value := r.Context().Value(key); value != nil {
+			return key + ":" + fmt.Sprint(value)
+		}
+		return RateLimitByIP(r)
+	}
+}
+
+var rateLimitCount int64
+
+// RateLimit rejects clients that make more than Limit requests every Window with
+// a 429 Too Many Requests. Responses include the `RateLimit-Limit`,
+// `RateLimit-Remaining` & `RateLimit-Reset` headers, rejected requests also get
+// `Retry-After`.
+//
+//	app.Use(gomek.RateLimit(gomek.RateLimitOptions{Limit: 100, Window: time.Minute}))
+func RateLimit(opts RateLimitOptions) func(next http.Handler) http.HandlerFunc {
+	if opts.Key == nil {
+		opts.Key = RateLimitByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = opts.Limit
+	}
+	prefix := opts.Group
+	if prefix == "" {
+		prefix = "limit" + strconv.FormatInt(atomic.AddInt64(&rateLimitCount, 1), 10)
+	}
+	policy := RateLimitPolicy{
+		Algorithm: opts.Algorithm,
+		Limit:     opts.Limit,
+		Window:    opts.Window,
+		Burst:     opts.Burst,
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", opts.Limit, int(math.Ceil(opts.Window.Seconds())))
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := opts.Store.Take(prefix+"|"+opts.Key(r), policy, time.Now())
+			if err != nil {
+				// Fail open rather than taking the app down with the store
+				log.Println("[GOMEK] Error: rate limit store", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			header := w.Header()
+			header.Set("RateLimit-Policy", policyHeader)
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+			if !result.Allowed {
+				retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				header.Set("Retry-After", strconv.Itoa(retryAfter))
+				httpError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit limits the current route, see `gomek.RateLimit`. Routes with the
+// same `RateLimitOptions.Group` share their limit.
+//
+//	app.Route("/search").View(search).Methods("GET").RateLimit(gomek.RateLimitOptions{
+//		Limit:     10,
+//		Window:    time.Minute,
+//		Algorithm: gomek.SLIDING_WINDOW,
+//		Group:     "search",
+//	})
+func (a *App) RateLimit(opts RateLimitOptions) *App {
+	if opts.Store == nil {
+		opts.Store = a.rateLimitStore()
+	}
+	a.currentMiddleware = append(a.currentMiddleware, RateLimit(opts))
+	return a
+}
+
+// rateLimitStore is shared by the app's routes so groups share their counts
+func (a *App) rateLimitStore() RateLimitStore {
+	a.rateLimitOnce.Do(func() {
+		a.rateLimits = NewMemoryRateLimitStore()
+	})
+	return a.rateLimits
+}
+
+type rateLimitEntry struct {
+	// Token bucket
+	tokens float64
+	last   time.Time
+	// Sliding window
+	start    time.Time
+	previous int
+	current  int
+	// Removed once idle past expires
+	expires time.Time
+}
+
+// MemoryRateLimitStore is an in-memory `RateLimitStore`
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an in-memory `RateLimitStore`
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: map[string]*rateLimitEntry{}}
+}
+
+func (m *MemoryRateLimitStore) Take(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > DEFAULT_RATE_LIMIT_SWEEP {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{tokens: float64(policy.Burst), last: now, start: now.Truncate(policy.Window)}
+		m.entries[key] = entry
+	}
+	// Idle keys are at their full limit again after two windows
+	entry.expires = now.Add(2 * policy.Window)
+	if policy.Algorithm == SLIDING_WINDOW {
+		return entry.slidingWindow(policy, now), nil
+	}
+	return entry.tokenBucket(policy, now), nil
+}
+
+func (e *rateLimitEntry) tokenBucket(policy RateLimitPolicy, now time.Time) RateLimitResult {
+	capacity := float64(policy.Burst)
+	rate := float64(policy.Limit) / policy.Window.Seconds()
+	e.tokens = math.Min(capacity, e.tokens+now.Sub(e.last).Seconds()*rate)
+	e.last = now
+	result := RateLimitResult{Limit: policy.Burst}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else if rate > 0 {
+		result.RetryAfter = time.Duration((1 - e.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(e.tokens)
+	if rate > 0 {
+		result.Reset = time.Duration((capacity - e.tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+func (e *rateLimitEntry) slidingWindow(policy RateLimitPolicy, now time.Time) RateLimitResult {
+	start := now.Truncate(policy.Window)
+	if !start.Equal(e.start) {
+		if start.Sub(e.start) == policy.Window {
+			e.previous = e.current
+		} else {
+			e.previous = 0
+		}
+		e.current = 0
+		e.start = start
+	}
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(policy.Window)
+	estimate := float64(e.previous)*weight + float64(e.current)
+	result := RateLimitResult{Limit: policy.Limit, Reset: policy.Window - elapsed}
+	if estimate+1 <= float64(policy.Limit) {
+		e.current++
+		estimate++
+		result.Allowed = true
+	} else if e.current >= policy.Limit {
+		result.RetryAfter = policy.Window - elapsed
+	} else {
+		// Wait for enough of the previous window to slide out
+		needed := 1 - float64(policy.Limit-1-e.current)/float64(e.previous)
+		result.RetryAfter = time.Duration(needed*float64(policy.Window)) - elapsed
+	}
+	result.Remaining = policy.Limit - int(math.Ceil(estimate))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
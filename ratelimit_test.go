@@ -0,0 +1,144 @@
+package gomek
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateLimitRequest(handler http.Handler, target string, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(RateLimitOptions{Limit: 2, Window: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	for i, remaining := range []string{"1", "0"} {
+		w := rateLimitRequest(handler, "/", "10.0.0.1:1234", nil)
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("Request %d: expected 200 with %s remaining got %d %v", i, remaining, w.Code, w.Header())
+		}
+		if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("Unexpected headers %v", w.Header())
+		}
+	}
+	w := rateLimitRequest(handler, "/", "10.0.0.1:5678", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected a 429 with Retry-After 30 got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Content-Type") != PROBLEM_CONTENT_TYPE {
+		t.Errorf("Expected a problem got %s", w.Header().Get("Content-Type"))
+	}
+	// Other clients have their own limit
+	if w := rateLimitRequest(handler, "/", "10.0.0.2:1234", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to be allowed got %d", w.Code)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(RateLimitOptions{Limit: 1, Window: time.Minute, Key: RateLimitByHeader("X-API-Key")})(ok)
+	rateLimitRequest(handler, "/", "10.0.0.1:1", http.Header{"X-Api-Key": {"a"}})
+	if w := rateLimitRequest(handler, "/", "10.0.0.1:1", http.Header{"X-Api-Key": {"b"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected another API key from the same IP to be allowed got %d", w.Code)
+	}
+	if w := rateLimitRequest(handler, "/", "10.0.0.2:1", http.Header{"X-Api-Key": {"a"}}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the same API key from another IP to be limited got %d", w.Code)
+	}
+
+	byUser := RateLimit(RateLimitOptions{Limit: 1, Window: time.Minute, Key: RateLimitByContext("userID")})(ok)
+	authorized := Authorize([][]string{}, func(r *http.Request) (bool, context.Context) {
+		return true, context.WithValue(r.Context(), "userID", r.Header.Get("User"))
+	})(byUser)
+	rateLimitRequest(authorized, "/", "10.0.0.1:1", http.Header{"User": {"1"}})
+	if w := rateLimitRequest(authorized, "/", "10.0.0.1:1", http.Header{"User": {"2"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected another user to be allowed got %d", w.Code)
+	}
+	if w := rateLimitRequest(authorized, "/", "10.0.0.1:1", http.Header{"User": {"1"}}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the same user to be limited got %d", w.Code)
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	app := New(Config{})
+	view := func(w http.ResponseWriter, r *http.Request, d *Data) {}
+	search := RateLimitOptions{Limit: 1, Window: time.Minute, Group: "search"}
+	app.Route("/search").View(view).Methods("GET").RateLimit(search)
+	app.Route("/suggest").View(view).Methods("GET").RateLimit(search)
+	app.Route("/login").View(view).Methods("GET").RateLimit(RateLimitOptions{Limit: 1, Window: time.Minute})
+	app.Route("/").View(view).Methods("GET")
+	handler := app.setup().Handler
+
+	rateLimitRequest(handler, "/search", "10.0.0.1:1", nil)
+	if w := rateLimitRequest(handler, "/suggest", "10.0.0.1:1", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the group to share a limit got %d", w.Code)
+	}
+	if w := rateLimitRequest(handler, "/login", "10.0.0.1:1", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected /login to have its own limit got %d", w.Code)
+	}
+	if w := rateLimitRequest(handler, "/", "10.0.0.1:1", nil); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected / not to be limited got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RateLimitPolicy{Algorithm: TOKEN_BUCKET, Limit: 10, Window: 10 * time.Second, Burst: 3}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if res, _ := store.Take("k", policy, now); !res.Allowed {
+			t.Fatalf("Expected the burst to be allowed")
+		}
+	}
+	res, _ := store.Take("k", policy, now)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("Expected a rejection with 1s retry got %+v", res)
+	}
+	// One token per second refills
+	if res, _ := store.Take("k", policy, now.Add(time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected a refilled token got %+v", res)
+	}
+	if res, _ := store.Take("k", policy, now.Add(time.Hour)); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("Expected a full bucket got %+v", res)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	policy := RateLimitPolicy{Algorithm: SLIDING_WINDOW, Limit: 4, Window: time.Minute}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if res, _ := store.Take("k", policy, start.Add(30*time.Second)); !res.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i)
+		}
+	}
+	res, _ := store.Take("k", policy, start.Add(30*time.Second))
+	if res.Allowed || res.RetryAfter != 30*time.Second {
+		t.Errorf("Expected a rejection until the next window got %+v", res)
+	}
+	// Half way through the next window half of the previous window still counts
+	next := start.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if res, _ := store.Take("k", policy, next); !res.Allowed {
+			t.Errorf("Expected request %d to be allowed", i)
+		}
+	}
+	res, _ = store.Take("k", policy, next)
+	if res.Allowed || res.RetryAfter != 15*time.Second {
+		t.Errorf("Expected a rejection with 15s retry got %+v", res)
+	}
+	// Idle keys start again
+	if res, _ := store.Take("k", policy, start.Add(time.Hour)); !res.Allowed || res.Remaining != 3 {
+		t.Errorf("Expected a fresh window got %+v", res)
+	}
+}
@@ -0,0 +1,261 @@
+package gomek
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedValue is returned by an Encoder that can't encode a value, e.g.
+// the CSV encoder given a single struct. `Respond` then tries the next acceptable
+// encoder.
+var ErrUnsupportedValue = errors.New("gomek: value not supported by encoder")
+
+// Encoder writes values as a single media type. Implement it to add a format to
+// `Respond`, see `RegisterEncoder`.
+type Encoder interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+var (
+	encodersMu sync.RWMutex
+	// The first encoder is used when the client accepts anything
+	encoders = []Encoder{
+		jsonEncoder{},
+		xmlEncoder{},
+		csvEncoder{},
+		msgpackEncoder{},
+	}
+)
+
+// RegisterEncoder adds an encoder for `Respond`, replacing any encoder already
+// registered for the same content type.
+//
+//	gomek.RegisterEncoder(YAMLEncoder{})
+func RegisterEncoder(e Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	for i, existing := range encoders {
+		if existing.ContentType() == e.ContentType() {
+			encoders[i] = e
+			return
+		}
+	}
+	encoders = append(encoders, e)
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string {
+	return "application/xml"
+}
+
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	b, err := xml.Marshal(v)
+	var unsupported *xml.UnsupportedTypeError
+	if errors.As(err, &unsupported) {
+		return ErrUnsupportedValue
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// csvEncoder writes a slice of structs as rows, with a header row taken from
+// each field's `csv` tag or name. A [][]string is written as is.
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string {
+	return "text/csv"
+}
+
+func (csvEncoder) Encode(w io.Writer, v interface{}) error {
+	cw := csv.NewWriter(w)
+	if records, ok := v.([][]string); ok {
+		cw.WriteAll(records)
+		return cw.Error()
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return ErrUnsupportedValue
+	}
+	elem := rv.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return ErrUnsupportedValue
+	}
+	var header []string
+	var fields []int
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		name := fieldName(f, "csv")
+		if f.PkgPath != "" || name == "" {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+	cw.Write(header)
+	for i := 0; i < rv.Len(); i++ {
+		row := rv.Index(i)
+		if row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				continue
+			}
+			row = row.Elem()
+		}
+		record := make([]string, len(fields))
+		for j, field := range fields {
+			record[j] = fmt.Sprint(row.Field(field).Interface())
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// mediaTypeAliases maps unregistered names clients send for a built in format
+var mediaTypeAliases = map[string]string{
+	"application/x-msgpack": "application/msgpack",
+}
+
+// mediaRange is a single entry of an Accept header
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the acceptable media ranges, most preferred first
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		if alias, ok := mediaTypeAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if parsed, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+		}
+	}
+	// Prefer higher q values, then more specific ranges
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+	return ranges
+}
+
+func (m mediaRange) matches(contentType string) bool {
+	if m.mediaType == "*/*" || m.mediaType == contentType {
+		return true
+	}
+	if strings.HasSuffix(m.mediaType, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(m.mediaType, "*"))
+	}
+	return false
+}
+
+// negotiate returns the registered encoders acceptable to the client, most preferred first
+func negotiate(accept string) []Encoder {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	var acceptable []Encoder
+	seen := map[string]bool{}
+	for _, m := range parseAccept(accept) {
+		for _, e := range encoders {
+			if !seen[e.ContentType()] && m.matches(e.ContentType()) {
+				seen[e.ContentType()] = true
+				acceptable = append(acceptable, e)
+			}
+		}
+	}
+	return acceptable
+}
+
+// Respond writes value with the encoder that best matches the request's `Accept`
+// header. JSON, XML, CSV (for slices of structs) & MessagePack are built in, see
+// `RegisterEncoder` to add more. JSON is used if the client accepts anything.
+// A 406 Not Acceptable is returned if no encoder matches.
+//
+//	func notices(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		notices := []Notice{{Name: "Joe"}}
+//		gomek.Respond(w, r, notices, http.StatusOK)
+//	}
+func Respond(w http.ResponseWriter, r *http.Request, value interface{}, status int) {
+	w.Header().Add("Vary", "Accept")
+	acceptable := negotiate(r.Header.Get("Accept"))
+	for _, e := range acceptable {
+		var buf bytes.Buffer
+		err := e.Encode(&buf, value)
+		if errors.Is(err, ErrUnsupportedValue) {
+			continue
+		}
+		if err != nil {
+			log.Println("[GOMEK] Error encoding response", err)
+			Problem(w, http.StatusInternalServerError, "", "", nil)
+			return
+		}
+		contentType := e.ContentType()
+		if strings.HasPrefix(contentType, "text/") {
+			contentType += "; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+		return
+	}
+	var available []string
+	encodersMu.RLock()
+	for _, e := range encoders {
+		available = append(available, e.ContentType())
+	}
+	encodersMu.RUnlock()
+	Problem(w, http.StatusNotAcceptable, "", "supported content types are "+strings.Join(available, ", "), nil)
+}
@@ -0,0 +1,96 @@
+package gomek
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testRow struct {
+	Name  string `json:"name" xml:"name" csv:"name"`
+	Count int    `json:"count" xml:"count" csv:"count"`
+}
+
+func respond(accept string, value interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/notices", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	Respond(w, req, value, http.StatusOK)
+	return w
+}
+
+func TestRespond(t *testing.T) {
+	rows := []testRow{{Name: "Joe", Count: 1}, {Name: "Cosmo", Count: 2}}
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/json", "[{\"name\":\"Joe\",\"count\":1},{\"name\":\"Cosmo\",\"count\":2}]\n"},
+		{"text/csv", "text/csv; charset=utf-8", "name,count\nJoe,1\nCosmo,2\n"},
+		{"application/xml;q=0.9, text/csv;q=0.1", "application/xml", ""},
+		{"application/*", "application/json", ""},
+		{"application/msgpack", "application/msgpack", ""},
+		{"application/x-msgpack", "application/msgpack", ""},
+	}
+	for _, test := range tests {
+		w := respond(test.accept, rows)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected %d got %d", http.StatusOK, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("Accept %s: expected %s got %s", test.accept, test.contentType, contentType)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("Accept %s: expected %q got %q", test.accept, test.body, w.Body.String())
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Expected Vary Accept got %s", vary)
+		}
+	}
+}
+
+func TestRespondFallsBackForUnsupportedValues(t *testing.T) {
+	w := respond("text/csv, application/json;q=0.5", testRow{Name: "Joe"})
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected application/json got %s", contentType)
+	}
+	// No acceptable encoder supports a channel
+	w = respond("application/msgpack, application/xml;q=0.5", make(chan int))
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected %d got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
+
+func TestRespondNotAcceptable(t *testing.T) {
+	w := respond("image/png", testRow{Name: "Joe"})
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected %d got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
+
+type testTextEncoder struct{}
+
+func (testTextEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func (testTextEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder(testTextEncoder{})
+	defer func() {
+		encoders = encoders[:len(encoders)-1]
+	}()
+	w := respond("text/plain", "hello")
+	if w.Body.String() != "hello" {
+		t.Errorf("Expected hello got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,159 @@
+package gomek
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// errHijackUnsupported is returned when hijacking a response writer that wraps
+// one without `http.Hijacker`, e.g. an HTTP/2 stream
+var errHijackUnsupported = errors.New("gomek: response writer does not support hijacking")
+
+// flush flushes w if it's an `http.Flusher`
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hijack takes over w's connection, see `http.Hijacker`
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackUnsupported
+	}
+	return hijacker.Hijack()
+}
+
+// statusWriter records the status & length of a response for middleware such
+// as `Logging`. It passes `http.Flusher` & `http.Hijacker` through so streaming
+// responses & WebSockets still work.
+type statusWriter struct {
+	http.ResponseWriter
+	Status int
+	Length int
+}
+
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	return &statusWriter{ResponseWriter: w}
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.Status == 0 {
+		s.Status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.Length += n
+	return n, err
+}
+
+func (s *statusWriter) Flush() {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	flush(s.ResponseWriter)
+}
+
+func (s *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := hijack(s.ResponseWriter)
+	if err == nil {
+		s.Status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// timeoutWriter is the response writer of a view with a `Timeout`. The view's
+// headers are kept apart until it starts its response so a timed out view can't
+// change the 503.
+type timeoutWriter struct {
+	w        http.ResponseWriter
+	header   http.Header
+	mu       sync.Mutex
+	started  bool
+	timedOut bool
+}
+
+func (t *timeoutWriter) Header() http.Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.started {
+		return t.w.Header()
+	}
+	return t.header
+}
+
+// start sends the view's headers, t.mu must be held
+func (t *timeoutWriter) start() {
+	t.started = true
+	header := t.w.Header()
+	for k, v := range t.header {
+		header[k] = v
+	}
+}
+
+func (t *timeoutWriter) WriteHeader(status int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut || t.started {
+		return
+	}
+	t.start()
+	t.w.WriteHeader(status)
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !t.started {
+		t.start()
+	}
+	return t.w.Write(b)
+}
+
+func (t *timeoutWriter) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return
+	}
+	if !t.started {
+		t.start()
+	}
+	flush(t.w)
+}
+
+func (t *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, brw, err := hijack(t.w)
+	if err == nil {
+		t.started = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+func (t *timeoutWriter) Unwrap() http.ResponseWriter {
+	return t.w
+}
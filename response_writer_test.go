@@ -0,0 +1,29 @@
+package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHijackUnsupported(t *testing.T) {
+	// httptest.ResponseRecorder can't be hijacked
+	writers := map[string]http.Hijacker{
+		"statusWriter":   newStatusWriter(httptest.NewRecorder()),
+		"timeoutWriter":  &timeoutWriter{w: httptest.NewRecorder(), header: http.Header{}},
+		"hookWriter":     &hookWriter{ResponseWriter: httptest.NewRecorder()},
+		"debugWriter":    &debugWriter{httptest.NewRecorder()},
+		"compressWriter": &compressWriter{ResponseWriter: httptest.NewRecorder()},
+		"etagWriter":     &etagWriter{ResponseWriter: httptest.NewRecorder()},
+	}
+	for name, w := range writers {
+		if _, _, err := w.Hijack(); err != errHijackUnsupported {
+			t.Errorf("%s: expected %v got %v", name, errHijackUnsupported, err)
+		}
+	}
+	sw := newStatusWriter(httptest.NewRecorder())
+	sw.Hijack()
+	if sw.Status != 0 {
+		t.Errorf("Expected a failed hijack to leave the status unset got %d", sw.Status)
+	}
+}
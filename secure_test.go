@@ -0,0 +1,109 @@
+package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecureHeaders(t *testing.T) {
+	handler := SecureHeaders(DefaultSecureHeaders)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSPNonce(r)))
+	}))
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	expected := map[string]string{
+		"X-Content-Type-Options":     "nosniff",
+		"X-Frame-Options":            "DENY",
+		"Referrer-Policy":            "strict-origin-when-cross-origin",
+		"Permissions-Policy":         "camera=(), microphone=(), geolocation=()",
+		"Cross-Origin-Opener-Policy": "same-origin",
+	}
+	for name, value := range expected {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s: expected %s got %s", name, value, got)
+		}
+	}
+	nonce := w.Body.String()
+	if len(nonce) != 22 || !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("Expected the CSP to contain the nonce %s got %s", nonce, w.Header().Get("Content-Security-Policy"))
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" || w.Header().Get("Cross-Origin-Embedder-Policy") != "" {
+		t.Errorf("Expected no HSTS over HTTP & no COEP got %v", w.Header())
+	}
+	// A new nonce for every request
+	w2 := httptest.NewRecorder()
+	handler(w2, httptest.NewRequest("GET", "/", nil))
+	if w2.Body.String() == nonce {
+		t.Errorf("Expected a new nonce")
+	}
+	// HSTS for HTTPS requests
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if value := w.Header().Get("Strict-Transport-Security"); value != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Expected HSTS got %s", value)
+	}
+}
+
+func TestSecureHeadersTemplate(t *testing.T) {
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "layout.gohtml")
+	os.WriteFile(layout, []byte(`{{ define "layout" }}<script nonce="{{ cspNonce }}"></script>{{ template "content" . }}{{ end }}`), 0600)
+	page := filepath.Join(dir, "page.gohtml")
+	os.WriteFile(page, []byte(`{{ define "content" }}{{ end }}`), 0600)
+
+	widget := DefaultSecureHeaders
+	widget.FrameOptions = ""
+	widget.ContentSecurityPolicy = "frame-ancestors https://partner.example.com; script-src 'nonce-{nonce}'"
+
+	app := New(Config{BaseTemplates: []string{layout}})
+	app.Use(SecureHeaders(DefaultSecureHeaders))
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET").Templates(page)
+	app.Route("/widget").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET").SecureHeaders(widget).Templates(page)
+	handler := app.setup().Handler
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	nonce := strings.TrimSuffix(strings.TrimPrefix(body, `<script nonce="`), `"></script>`)
+	if nonce == body || !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("Expected the template nonce to match the CSP got %s %s", body, w.Header().Get("Content-Security-Policy"))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/widget", nil))
+	nonce = strings.TrimSuffix(strings.TrimPrefix(w.Body.String(), `<script nonce="`), `"></script>`)
+	if w.Header().Get("X-Frame-Options") != "" || w.Header().Get("Content-Security-Policy") != "frame-ancestors https://partner.example.com; script-src 'nonce-"+nonce+"'" {
+		t.Errorf("Expected the route's headers got %v", w.Header())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected the other headers to be kept got %v", w.Header())
+	}
+}
+
+func TestSecureHeadersCache(t *testing.T) {
+	layout := filepath.Join(t.TempDir(), "layout.gohtml")
+	os.WriteFile(layout, []byte(`{{ define "layout" }}<script nonce="{{ cspNonce }}"></script>{{ end }}`), 0600)
+
+	app := New(Config{})
+	app.Use(SecureHeaders(DefaultSecureHeaders))
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET").Cache(time.Minute).Templates(layout)
+	handler := app.setup().Handler
+
+	for _, status := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Header().Get(CACHE_STATUS_HEADER) != status {
+			t.Fatalf("Expected %s got %s", status, w.Header().Get(CACHE_STATUS_HEADER))
+		}
+		nonce := strings.TrimSuffix(strings.TrimPrefix(w.Body.String(), `<script nonce="`), `"></script>`)
+		if !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+			t.Errorf("%s: Expected the cached nonce %s in the CSP got %s", status, nonce, w.Header().Get("Content-Security-Policy"))
+		}
+	}
+}
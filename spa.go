@@ -0,0 +1,75 @@
+package gomek
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// spaFiles serves a single page app's bundle, falling back to its index file
+type spaFiles struct {
+	*staticFiles
+	index string
+	// reserved are the first path segments of the app's routes, e.g. "api"
+	reserved map[string]bool
+}
+
+// SPA serves a single page app's bundle under prefix. Files in the bundle are
+// served like `Static`, other paths return the index file so client side routing
+// works. Missing assets, non GET requests & paths under the first segment of a
+// route registered with `Route`, e.g. /api, still return a 404.
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	bundle, _ := fs.Sub(dist, "dist")
+//	app.SPA("/app", bundle, "index.html")
+func (a *App) SPA(prefix string, root interface{}, index string, opts ...StaticOptions) {
+	a.spas = append(a.spas, &spaFiles{
+		staticFiles: newStaticFiles(prefix, root, opts),
+		index:       index,
+	})
+}
+
+// routeRoots returns the first path segment of every route
+func (a *App) routeRoots() map[string]bool {
+	roots := map[string]bool{}
+	for _, v := range a.view.StoredViews {
+		if root := strings.Split(strings.TrimPrefix(v.Route, "/"), "/")[0]; root != "" {
+			roots[root] = true
+		}
+	}
+	return roots
+}
+
+// fallback reports whether the index file should be served for the request
+func (s *spaFiles) fallback(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	// Missing assets such as /app/main.js are a 404
+	if path.Ext(r.URL.Path) != "" {
+		return false
+	}
+	root := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0]
+	if s.prefix == "/" && s.reserved[root] {
+		return false
+	}
+	return !strings.Contains(r.Header.Get("Accept"), "json")
+}
+
+func (s *spaFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if name, ok := s.name(r.URL.Path); ok {
+		if info, err := fs.Stat(s.fsys, name); err == nil && !info.IsDir() {
+			s.staticFiles.ServeHTTP(w, r)
+			return
+		}
+	}
+	if !s.fallback(r) {
+		httpError(w, r, http.StatusNotFound, "no route matches "+r.URL.Path)
+		return
+	}
+	// Clients must revalidate the index so they pick up new bundles
+	s.serveFile(w, r, s.index, "no-cache")
+}
@@ -0,0 +1,73 @@
+package gomek
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+var testSPAFS = fstest.MapFS{
+	"index.html":             {Data: []byte("<div id=root></div>")},
+	"assets/app.1a2b3c4d.js": {Data: []byte("render()")},
+}
+
+func newSPAApp(prefix string) http.Handler {
+	app := New(Config{})
+	app.Route("/api/users").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, []string{"joe"}, http.StatusOK)
+	}).Methods("GET")
+	app.SPA(prefix, testSPAFS, "index.html")
+	return app.setup().Handler
+}
+
+func TestSPA(t *testing.T) {
+	handler := newSPAApp("/")
+	html := http.Header{"Accept": {"text/html"}}
+	tests := []struct {
+		method string
+		target string
+		header http.Header
+		status int
+		body   string
+	}{
+		{"GET", "/", html, http.StatusOK, "<div id=root></div>"},
+		{"GET", "/settings/profile", html, http.StatusOK, "<div id=root></div>"},
+		{"GET", "/assets/app.1a2b3c4d.js", nil, http.StatusOK, "render()"},
+		{"GET", "/api/users", nil, http.StatusOK, "[\"joe\"]\n"},
+		// Unknown API paths & missing assets aren't shadowed by the index
+		{"GET", "/api/unknown", html, http.StatusNotFound, ""},
+		{"GET", "/assets/missing.js", nil, http.StatusNotFound, ""},
+		{"GET", "/settings", http.Header{"Accept": {"application/json"}}, http.StatusNotFound, ""},
+		{"POST", "/settings", html, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serveStatic(handler, tt.method, tt.target, tt.header)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d got %d", tt.method, tt.target, tt.status, w.Code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s: expected %q got %q", tt.method, tt.target, tt.body, w.Body.String())
+		}
+	}
+	w := serveStatic(handler, "GET", "/settings", html)
+	if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected the index to be revalidated got %s", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestSPAPrefix(t *testing.T) {
+	handler := newSPAApp("/app")
+	html := http.Header{"Accept": {"text/html"}}
+	if w := serveStatic(handler, "GET", "/app/dashboard", html); w.Body.String() != "<div id=root></div>" {
+		t.Errorf("Expected the index got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveStatic(handler, "GET", "/app/assets/app.1a2b3c4d.js", nil); w.Body.String() != "render()" {
+		t.Errorf("Expected the asset got %d %s", w.Code, w.Body.String())
+	}
+	if w := serveStatic(handler, "GET", "/other", html); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 outside of the prefix got %d", w.Code)
+	}
+	if w := serveStatic(handler, "GET", "/api/users", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the API route got %d", w.Code)
+	}
+}
@@ -0,0 +1,295 @@
+package gomek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Comment lines are sent this often to keep idle connections open through proxies
+	DEFAULT_SSE_HEARTBEAT = 15 * time.Second
+	// Events a Broker keeps to replay to clients that reconnect with Last-Event-ID
+	DEFAULT_BROKER_HISTORY = 100
+)
+
+// ErrStreamingUnsupported is returned by `SSE` when the response writer can't be flushed
+var ErrStreamingUnsupported = errors.New("gomek: response writer does not support flushing")
+
+// Event is a single Server-Sent Event. Data that isn't a string or []byte is
+// encoded as JSON.
+type Event struct {
+	Name string
+	ID   string
+	Data interface{}
+}
+
+// EventStream writes Server-Sent Events to a client, see `SSE`
+type EventStream struct {
+	// LastEventID is the `Last-Event-ID` header sent by a reconnecting client
+	LastEventID string
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	ctx         context.Context
+	mu          sync.Mutex
+	closed      chan struct{}
+	heartbeat   sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+// SSE starts a `text/event-stream` response. A heartbeat comment is sent every
+// `DEFAULT_SSE_HEARTBEAT` & the stream stops once the client disconnects. Close
+// must be called before the view returns.
+//
+// The stream isn't cut off by `Config.WriteTimeout`.
+//
+//	func events(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		stream, err := gomek.SSE(w, r)
+//		if err != nil {
+//			return
+//		}
+//		defer stream.Close()
+//		for {
+//			select {
+//			case n := <-notices:
+//				stream.Send("notice", n.ID, n)
+//			case <-stream.Done():
+//				return
+//			}
+//		}
+//	}
+func SSE(w http.ResponseWriter, r *http.Request) (*EventStream, error) {
+	return newEventStream(w, r, DEFAULT_SSE_HEARTBEAT)
+}
+
+func newEventStream(w http.ResponseWriter, r *http.Request, heartbeat time.Duration) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	s := &EventStream{
+		LastEventID: r.Header.Get("Last-Event-ID"),
+		w:           w,
+		flusher:     flusher,
+		ctx:         r.Context(),
+		closed:      make(chan struct{}),
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	clearWriteDeadline(w, r)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	s.heartbeat.Add(1)
+	go s.sendHeartbeats(heartbeat)
+	return s, nil
+}
+
+func (s *EventStream) sendHeartbeats(interval time.Duration) {
+	defer s.heartbeat.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.write(": heartbeat\n\n")
+		case <-s.ctx.Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func (s *EventStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closed:
+		return errors.New("gomek: event stream closed")
+	default:
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(s.w, msg); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Send writes an event. event & id are optional. data that isn't a string or
+// []byte is encoded as JSON.
+//
+//	stream.Send("notice", "42", notice)
+func (s *EventStream) Send(event string, id string, data interface{}) error {
+	var payload string
+	switch d := data.(type) {
+	case string:
+		payload = d
+	case []byte:
+		payload = string(d)
+	default:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(b)
+	}
+	var msg strings.Builder
+	if event != "" {
+		msg.WriteString("event: " + sanitizeField(event) + "\n")
+	}
+	if id != "" {
+		msg.WriteString("id: " + sanitizeField(id) + "\n")
+	}
+	payload = strings.ReplaceAll(payload, "\r\n", "\n")
+	for _, line := range strings.Split(payload, "\n") {
+		msg.WriteString("data: " + line + "\n")
+	}
+	msg.WriteString("\n")
+	return s.write(msg.String())
+}
+
+// SendEvent writes e, see `Send`
+func (s *EventStream) SendEvent(e Event) error {
+	return s.Send(e.Name, e.ID, e.Data)
+}
+
+// sanitizeField stops event names & ids from breaking out of their line
+func sanitizeField(v string) string {
+	return strings.NewReplacer("\n", "", "\r", "").Replace(v)
+}
+
+// Done is closed when the client disconnects
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close stops the heartbeat. No more events can be sent.
+func (s *EventStream) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		close(s.closed)
+		s.mu.Unlock()
+	})
+	s.heartbeat.Wait()
+}
+
+// Broker broadcasts events to many subscribers, e.g. all the clients of an SSE
+// route. Events are dropped for subscribers that aren't keeping up rather than
+// blocking the publisher.
+//
+//	broker := gomek.NewBroker()
+//	app.Route("/events").View(func(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		broker.Serve(w, r)
+//	}).Methods("GET")
+//
+//	broker.Publish(gomek.Event{Name: "notice", Data: notice})
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+	history     []Event
+	nextID      int
+}
+
+// NewBroker creates a Broker that remembers the last `DEFAULT_BROKER_HISTORY`
+// events for clients that reconnect
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Subscribe returns a channel that receives published events & a function that
+// unsubscribes it
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish sends e to every subscriber. Events without an ID are given one so
+// clients can resume with Last-Event-ID.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	if e.ID == "" {
+		e.ID = fmt.Sprint(b.nextID)
+	}
+	b.history = append(b.history, e)
+	if len(b.history) > DEFAULT_BROKER_HISTORY {
+		b.history = b.history[1:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// since returns the remembered events published after the event with id lastID
+func (b *Broker) since(lastID string) []Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i, e := range b.history {
+		if e.ID == lastID {
+			return append([]Event(nil), b.history[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// Serve streams published events to the client until it disconnects. Events
+// missed since the client's Last-Event-ID are replayed first.
+func (b *Broker) Serve(w http.ResponseWriter, r *http.Request) error {
+	events, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+	stream, err := SSE(w, r)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	replayed := map[string]bool{}
+	if stream.LastEventID != "" {
+		for _, e := range b.since(stream.LastEventID) {
+			replayed[e.ID] = true
+			if err := stream.SendEvent(e); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		select {
+		case e := <-events:
+			// Already sent when replaying
+			if replayed[e.ID] {
+				continue
+			}
+			if err := stream.SendEvent(e); err != nil {
+				return err
+			}
+		case <-stream.Done():
+			return nil
+		}
+	}
+}
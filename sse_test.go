@@ -0,0 +1,191 @@
+package gomek
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads lines up to the blank line that ends an event
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if line == "\n" {
+			return strings.Join(lines, "")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestSSEThroughMiddleware(t *testing.T) {
+	sent := make(chan struct{})
+	app := New(Config{})
+	app.Use(Logging)
+	app.Route("/events").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		stream, err := SSE(w, r)
+		if err != nil {
+			t.Errorf("Expected nil got %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Send("notice", "1", map[string]string{"name": "Joe"})
+		stream.Send("", "", "line one\nline two")
+		close(sent)
+		<-stream.Done()
+	}).Methods("GET")
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected text/event-stream got %s", contentType)
+	}
+	<-sent
+	reader := bufio.NewReader(resp.Body)
+	expected := "event: notice\nid: 1\ndata: {\"name\":\"Joe\"}\n"
+	if event := readEvent(t, reader); event != expected {
+		t.Errorf("Expected %q got %q", expected, event)
+	}
+	expected = "data: line one\ndata: line two\n"
+	if event := readEvent(t, reader); event != expected {
+		t.Errorf("Expected %q got %q", expected, event)
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	w := httptest.NewRecorder()
+	stream, err := newEventStream(w, req, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	stream.Close()
+	if !strings.Contains(w.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("Expected a heartbeat got %q", w.Body.String())
+	}
+	if err := stream.Send("", "", "late"); err == nil {
+		t.Errorf("Expected an error sending on a closed stream")
+	}
+}
+
+type noFlushWriter struct {
+	http.ResponseWriter
+}
+
+func TestSSEStreamingUnsupported(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	w := noFlushWriter{httptest.NewRecorder()}
+	if _, err := SSE(w, req); err != ErrStreamingUnsupported {
+		t.Errorf("Expected %v got %v", ErrStreamingUnsupported, err)
+	}
+}
+
+func TestBrokerReplaysFromLastEventID(t *testing.T) {
+	broker := NewBroker()
+	broker.Publish(Event{Name: "notice", Data: "first"})
+	broker.Publish(Event{Name: "notice", Data: "second"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		broker.Serve(w, r)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	expected := "event: notice\nid: 2\ndata: second\n"
+	if event := readEvent(t, reader); event != expected {
+		t.Errorf("Expected %q got %q", expected, event)
+	}
+
+	// The client subscribed before the replayed events were sent
+	broker.Publish(Event{Name: "notice", Data: "third"})
+	expected = "event: notice\nid: 3\ndata: third\n"
+	if event := readEvent(t, reader); event != expected {
+		t.Errorf("Expected %q got %q", expected, event)
+	}
+}
+
+func TestSSEWriteTimeout(t *testing.T) {
+	app := New(Config{WriteTimeout: 50 * time.Millisecond})
+	app.Route("/events").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		stream, err := SSE(w, r)
+		if err != nil {
+			t.Errorf("Expected nil got %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Send("", "1", "first")
+		time.Sleep(150 * time.Millisecond)
+		stream.Send("", "2", "second")
+		<-stream.Done()
+	}).Methods("GET")
+	srv := app.setup()
+	server := httptest.NewUnstartedServer(srv.Handler)
+	server.Config.WriteTimeout = srv.WriteTimeout
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []string{"id: 1\ndata: first\n", "id: 2\ndata: second\n"} {
+		if event := readEvent(t, reader); event != expected {
+			t.Errorf("Expected %q got %q", expected, event)
+		}
+	}
+}
+
+func TestSSEViewTimeout(t *testing.T) {
+	done := make(chan error, 1)
+	app := New(Config{})
+	app.Route("/events").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		stream, err := SSE(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer stream.Close()
+		stream.Send("", "1", "first")
+		<-stream.Done()
+		done <- r.Context().Err()
+	}).Methods("GET").Timeout(50 * time.Millisecond)
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d got %d", http.StatusOK, resp.StatusCode)
+	}
+	if event := readEvent(t, bufio.NewReader(resp.Body)); event != "id: 1\ndata: first\n" {
+		t.Errorf("Expected the first event got %q", event)
+	}
+	// The stream is ended by the route's timeout
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("Expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
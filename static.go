@@ -0,0 +1,252 @@
+package gomek
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Cache lifetime of fingerprinted static files
+	STATIC_IMMUTABLE_MAX_AGE = 365 * 24 * time.Hour
+	// Query parameter holding the content hash added by the `static` template function
+	STATIC_VERSION_PARAM = "v"
+)
+
+// Filenames such as app.3f2a9c1b.js are fingerprinted by bundlers
+var fingerprintPattern = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^/]+$`)
+
+// StaticOptions configures the files served by `App.Static`
+type StaticOptions struct {
+	// MaxAge clients may cache files that aren't fingerprinted for. By default
+	// clients revalidate them with their ETag on every request.
+	MaxAge time.Duration
+	// DisablePrecompressed stops `.br` & `.gz` variants from being served
+	DisablePrecompressed bool
+}
+
+type staticHash struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
+
+// staticFiles serves the files of fsys under prefix
+type staticFiles struct {
+	prefix string
+	fsys   fs.FS
+	opts   StaticOptions
+	mu     sync.Mutex
+	hashes map[string]staticHash
+}
+
+// Static serves the files in root under prefix. root is either a directory path
+// or an `fs.FS` such as an `embed.FS`. Files are served with an ETag &
+// Last-Modified header, directories are never listed. Requests pass through the
+// app's middleware, so whitelist the prefix when using `Authorize`.
+//
+//	app.Static("/static/", "./public")
+//	app.Static("/assets/", assetsFS, gomek.StaticOptions{MaxAge: time.Hour})
+//
+// Fingerprinted files, e.g. app.3f2a9c1b.js, & URLs returned by the `static`
+// template function are cached by clients for a year
+//
+//	<link rel="stylesheet" href="{{ static "/static/css/app.css" }}">
+func (a *App) Static(prefix string, root interface{}, opts ...StaticOptions) {
+	a.statics = append(a.statics, newStaticFiles(prefix, root, opts))
+}
+
+func newStaticFiles(prefix string, root interface{}, opts []StaticOptions) *staticFiles {
+	var fsys fs.FS
+	switch r := root.(type) {
+	case string:
+		fsys = os.DirFS(r)
+	case fs.FS:
+		fsys = r
+	default:
+		out := fmt.Sprintf("[GOMEK]: Error static root must be a directory or fs.FS, got %T", root)
+		log.Fatalf(PrintWithColor(out, RED))
+	}
+	s := &staticFiles{
+		prefix: "/" + strings.Trim(prefix, "/") + "/",
+		fsys:   fsys,
+		hashes: map[string]staticHash{},
+	}
+	if s.prefix == "//" {
+		s.prefix = "/"
+	}
+	if len(opts) > 0 {
+		s.opts = opts[0]
+	}
+	return s
+}
+
+// name returns the file name within fsys for a URL path
+func (s *staticFiles) name(urlPath string) (string, bool) {
+	if !strings.HasPrefix(urlPath, s.prefix) {
+		return "", false
+	}
+	name := path.Clean("/" + strings.TrimPrefix(urlPath, s.prefix))[1:]
+	if name == "" || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// hash returns a hash of the file's contents, cached until the file changes
+func (s *staticFiles) hash(name string) (string, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	cached, ok := s.hashes[name]
+	s.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.sum, nil
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))[:16]
+	s.mu.Lock()
+	s.hashes[name] = staticHash{modTime: info.ModTime(), size: info.Size(), sum: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+// acceptsEncoding reports whether the client accepts the content coding
+func acceptsEncoding(r *http.Request, coding string) bool {
+	q, ok := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))[coding]
+	return ok && q > 0
+}
+
+// variant returns the precompressed file to serve & its content coding
+func (s *staticFiles) variant(r *http.Request, name string) (string, string) {
+	if s.opts.DisablePrecompressed {
+		return name, ""
+	}
+	for _, v := range []struct{ coding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(r, v.coding) {
+			continue
+		}
+		if info, err := fs.Stat(s.fsys, name+v.ext); err == nil && !info.IsDir() {
+			return name + v.ext, v.coding
+		}
+	}
+	return name, ""
+}
+
+func (s *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpError(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+		return
+	}
+	name, ok := s.name(r.URL.Path)
+	if !ok {
+		httpError(w, r, http.StatusNotFound, "no file matches "+r.URL.Path)
+		return
+	}
+	s.serveFile(w, r, name, s.cacheControl(r, name))
+}
+
+// serveFile serves name, or its precompressed variant
+func (s *staticFiles) serveFile(w http.ResponseWriter, r *http.Request, name string, cacheControl string) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil || info.IsDir() {
+		httpError(w, r, http.StatusNotFound, "no file matches "+r.URL.Path)
+		return
+	}
+	servedName, coding := s.variant(r, name)
+	sum, err := s.hash(servedName)
+	if err != nil {
+		log.Println("[GOMEK] Error: reading static file", err)
+		httpError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	header := w.Header()
+	if !s.opts.DisablePrecompressed {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if coding != "" {
+		header.Set("Content-Encoding", coding)
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("ETag", `"`+sum+`"`)
+	header.Set("Cache-Control", cacheControl)
+	f, err := s.fsys.Open(servedName)
+	if err != nil {
+		httpError(w, r, http.StatusNotFound, "no file matches "+r.URL.Path)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			httpError(w, r, http.StatusInternalServerError, "")
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// cacheControl lets clients cache fingerprinted files forever, others use MaxAge
+func (s *staticFiles) cacheControl(r *http.Request, name string) string {
+	immutable := fingerprintPattern.MatchString(name)
+	if v := r.URL.Query().Get(STATIC_VERSION_PARAM); v != "" && !immutable {
+		sum, err := s.hash(name)
+		immutable = err == nil && v == sum
+	}
+	if immutable {
+		return fmt.Sprintf("public, max-age=%d, immutable", int(STATIC_IMMUTABLE_MAX_AGE.Seconds()))
+	}
+	if s.opts.MaxAge > 0 {
+		return fmt.Sprintf("public, max-age=%d", int(s.opts.MaxAge.Seconds()))
+	}
+	return "no-cache"
+}
+
+// staticURL is the `static` template function. It adds the file's content hash
+// to urlPath so clients fetch the new file as soon as it changes.
+func (a *App) staticURL(urlPath string) string {
+	for _, s := range a.statics {
+		name, ok := s.name(urlPath)
+		if !ok {
+			continue
+		}
+		sum, err := s.hash(name)
+		if err != nil {
+			continue
+		}
+		return urlPath + "?" + STATIC_VERSION_PARAM + "=" + sum
+	}
+	log.Printf("[GOMEK] Warning: no static file matches %s\n", urlPath)
+	return urlPath
+}
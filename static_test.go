@@ -0,0 +1,159 @@
+package gomek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testStaticFS = fstest.MapFS{
+	"css/app.css":         {Data: []byte("body{}"), ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	"css/app.css.br":      {Data: []byte("brotli")},
+	"css/app.css.gz":      {Data: []byte("gzip")},
+	"js/app.3f2a9c1b.js":  {Data: []byte("console.log(1)")},
+	"css/fonts/.keep":     {Data: []byte("")},
+	"templates/page.html": {Data: []byte("<p></p>")},
+}
+
+func newStaticApp(opts ...StaticOptions) http.Handler {
+	app := New(Config{})
+	app.Static("/static/", testStaticFS, opts...)
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	return app.setup().Handler
+}
+
+func serveStatic(handler http.Handler, method string, target string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestStatic(t *testing.T) {
+	handler := newStaticApp()
+	w := serveStatic(handler, "GET", "/static/css/app.css", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Fatalf("Expected 200 body{} got %d %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("Expected an ETag & Last-Modified got %v", w.Header())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Expected no-cache got %s", cc)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("Expected text/css got %s", ct)
+	}
+	// Conditional requests
+	w = serveStatic(handler, "GET", "/static/css/app.css", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 got %d", w.Code)
+	}
+	w = serveStatic(handler, "GET", "/static/css/app.css", http.Header{"If-Modified-Since": {"Tue, 02 Jan 2024 03:04:05 GMT"}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 got %d", w.Code)
+	}
+	w = serveStatic(handler, "HEAD", "/static/css/app.css", nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty 200 got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStaticNotFound(t *testing.T) {
+	handler := newStaticApp()
+	for _, target := range []string{"/static/", "/static/css", "/static/css/", "/static/missing.css"} {
+		if w := serveStatic(handler, "GET", target, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 got %d %s", target, w.Code, w.Body.String())
+		}
+	}
+	// The mux redirects paths that escape the prefix to their clean path
+	for _, target := range []string{"/static/../static.go", "/static/%2e%2e/gomek.go"} {
+		if w := serveStatic(handler, "GET", target, nil); w.Code != http.StatusMovedPermanently || strings.HasPrefix(w.Header().Get("Location"), "/static/") {
+			t.Errorf("%s: expected a redirect out of /static/ got %d %s", target, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if w := serveStatic(handler, "POST", "/static/css/app.css", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 got %d", w.Code)
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	handler := newStaticApp()
+	tests := []struct {
+		accept   string
+		body     string
+		encoding string
+	}{
+		{"gzip, deflate, br", "brotli", "br"},
+		{"gzip", "gzip", "gzip"},
+		{"br;q=0, gzip", "gzip", "gzip"},
+		{"", "body{}", ""},
+	}
+	etags := map[string]bool{}
+	for _, tt := range tests {
+		w := serveStatic(handler, "GET", "/static/css/app.css", http.Header{"Accept-Encoding": {tt.accept}})
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("%q: expected %s %s got %s %s", tt.accept, tt.body, tt.encoding, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: unexpected headers %v", tt.accept, w.Header())
+		}
+		etags[w.Header().Get("ETag")] = true
+	}
+	if len(etags) != 3 {
+		t.Errorf("Expected each encoding to have its own ETag got %v", etags)
+	}
+	handler = newStaticApp(StaticOptions{DisablePrecompressed: true, MaxAge: time.Hour})
+	w := serveStatic(handler, "GET", "/static/css/app.css", http.Header{"Accept-Encoding": {"br"}})
+	if w.Body.String() != "body{}" || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("Expected the uncompressed file got %s %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestStaticFingerprinted(t *testing.T) {
+	handler := newStaticApp()
+	immutable := "public, max-age=31536000, immutable"
+	if w := serveStatic(handler, "GET", "/static/js/app.3f2a9c1b.js", nil); w.Header().Get("Cache-Control") != immutable {
+		t.Errorf("Expected %s got %s", immutable, w.Header().Get("Cache-Control"))
+	}
+	if w := serveStatic(handler, "GET", "/static/css/app.css?v=stale", nil); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected no-cache for a stale version got %s", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestStaticTemplateFunc(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0600)
+	layout := filepath.Join(dir, "layout.gohtml")
+	os.WriteFile(layout, []byte(`{{ define "layout" }}{{ static "/public/app.css" }} {{ upper "a" }}{{ end }}`), 0600)
+
+	app := New(Config{TemplateFuncs: map[string]interface{}{"upper": strings.ToUpper}})
+	app.Static("/public", dir)
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET").Templates(layout)
+	handler := app.setup().Handler
+
+	w := serveStatic(handler, "GET", "/", nil)
+	url, rest, _ := strings.Cut(w.Body.String(), " ")
+	if !strings.HasPrefix(url, "/public/app.css?v=") || rest != "A" {
+		t.Fatalf("Expected a versioned URL got %s", w.Body.String())
+	}
+	w = serveStatic(handler, "GET", url, nil)
+	if w.Body.String() != "body{}" || w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("Expected an immutable file got %s %v", w.Body.String(), w.Header())
+	}
+	// Changing the file changes its URL
+	os.WriteFile(filepath.Join(dir, "app.css"), []byte("body{color:red}"), 0600)
+	os.Chtimes(filepath.Join(dir, "app.css"), time.Now(), time.Now().Add(time.Minute))
+	if w := serveStatic(handler, "GET", "/", nil); strings.HasPrefix(w.Body.String(), url) {
+		t.Errorf("Expected a new URL got %s", w.Body.String())
+	}
+}
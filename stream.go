@@ -0,0 +1,135 @@
+package gomek
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Streamed responses are flushed after this many values or this long since the
+	// last flush, whichever comes first
+	DEFAULT_STREAM_FLUSH_EVERY    = 100
+	DEFAULT_STREAM_FLUSH_INTERVAL = time.Second
+	// Trailer that holds the error that stopped a stream early
+	STREAM_ERROR_TRAILER = "X-Stream-Error"
+)
+
+// Iterator returns the next value to stream. ok is false once there are no more
+// values. A non nil error stops the stream.
+type Iterator[T any] func() (value T, ok bool, err error)
+
+// FromChannel creates an Iterator that yields values until ch is closed
+//
+//	gomek.StreamJSON(w, r, gomek.FromChannel(rows))
+func FromChannel[T any](ch <-chan T) Iterator[T] {
+	return func() (T, bool, error) {
+		v, ok := <-ch
+		return v, ok, nil
+	}
+}
+
+// FromSlice creates an Iterator that yields each value of s
+func FromSlice[T any](s []T) Iterator[T] {
+	i := 0
+	return func() (T, bool, error) {
+		var zero T
+		if i >= len(s) {
+			return zero, false, nil
+		}
+		i++
+		return s[i-1], true, nil
+	}
+}
+
+// wantsNDJSON reports whether the client asked for newline delimited JSON
+func wantsNDJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/x-ndjson") || strings.Contains(accept, "application/jsonl")
+}
+
+// StreamJSON writes each value from iter as it is produced, so large result sets
+// don't have to be held in memory. Clients that accept `application/x-ndjson` get
+// one JSON value per line, all others get a JSON array. The response is flushed
+// periodically & streaming stops when the request context is cancelled.
+//
+// Errors from iter or encoding are returned & sent to the client in the
+// `X-Stream-Error` trailer, as the status has already been written. A JSON array
+// is always closed so the body stays valid JSON.
+//
+// The stream isn't cut off by `Config.WriteTimeout`.
+//
+//	func export(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		rows := make(chan Notice)
+//		go queryNotices(r.Context(), rows)
+//		gomek.StreamJSON(w, r, gomek.FromChannel(rows))
+//	}
+func StreamJSON[T any](w http.ResponseWriter, r *http.Request, iter Iterator[T]) error {
+	ndjson := wantsNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Trailer", STREAM_ERROR_TRAILER)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	clearWriteDeadline(w, r)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	ctx := r.Context()
+	unflushed := 0
+	lastFlush := time.Now()
+	err := func() error {
+		if !ndjson {
+			if _, err := w.Write([]byte("[")); err != nil {
+				return err
+			}
+		}
+		for i := 0; ; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			value, ok, err := iter()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			b, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			if ndjson {
+				b = append(b, '\n')
+			} else if i > 0 {
+				b = append([]byte(","), b...)
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			unflushed++
+			if unflushed >= DEFAULT_STREAM_FLUSH_EVERY || time.Since(lastFlush) >= DEFAULT_STREAM_FLUSH_INTERVAL {
+				flush()
+				unflushed = 0
+				lastFlush = time.Now()
+			}
+		}
+	}()
+	if !ndjson {
+		w.Write([]byte("]\n"))
+	}
+	if err != nil {
+		w.Header().Set(STREAM_ERROR_TRAILER, err.Error())
+	}
+	flush()
+	return err
+}
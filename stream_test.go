@@ -0,0 +1,98 @@
+package gomek
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamJSONArray(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	w := httptest.NewRecorder()
+	err := StreamJSON(w, req, FromSlice([]testRow{{Name: "Joe", Count: 1}, {Name: "Ram", Count: 2}}))
+	if err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	expected := `[{"name":"Joe","count":1},{"name":"Ram","count":2}]` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+	if !w.Flushed {
+		t.Errorf("Expected the response to be flushed")
+	}
+}
+
+func TestStreamJSONNDJSON(t *testing.T) {
+	rows := make(chan testRow)
+	go func() {
+		rows <- testRow{Name: "Joe", Count: 1}
+		rows <- testRow{Name: "Ram", Count: 2}
+		close(rows)
+	}()
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	if err := StreamJSON(w, req, FromChannel(rows)); err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	expected := `{"name":"Joe","count":1}` + "\n" + `{"name":"Ram","count":2}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected %s got '%v'", expected, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected application/x-ndjson got %s", contentType)
+	}
+}
+
+func TestStreamJSONErrorTrailer(t *testing.T) {
+	queryErr := errors.New("connection reset")
+	calls := 0
+	iter := func() (testRow, bool, error) {
+		calls++
+		if calls > 1 {
+			return testRow{}, false, queryErr
+		}
+		return testRow{Name: "Joe", Count: 1}, true, nil
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamJSON[testRow](w, r, iter)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	expected := `[{"name":"Joe","count":1}]` + "\n"
+	if string(body) != expected {
+		t.Errorf("Expected %s got '%v'", expected, string(body))
+	}
+	if trailer := resp.Trailer.Get(STREAM_ERROR_TRAILER); trailer != queryErr.Error() {
+		t.Errorf("Expected %s got '%s'", queryErr.Error(), trailer)
+	}
+}
+
+func TestStreamJSONContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(ctx)
+	calls := 0
+	iter := func() (int, bool, error) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return calls, true, nil
+	}
+	w := httptest.NewRecorder()
+	if err := StreamJSON[int](w, req, iter); err != context.Canceled {
+		t.Errorf("Expected %v got %v", context.Canceled, err)
+	}
+	if w.Body.String() != "[1,2,3]\n" {
+		t.Errorf("Expected [1,2,3] got '%v'", w.Body.String())
+	}
+}
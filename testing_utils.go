@@ -25,7 +25,7 @@ import "net/http"
 //	if err != nil {
 //	t.Errorf("Error: %v", err)
 //	}
-//	expected := `{"name":"Joe"}`
+//	expected := `{"name":"Joe"}` + "\n"
 //	if string(data) != expected {
 //	t.Errorf("Expected %s got '%v'", expected, string(data))
 func CreateTestHandler(testApp IApp, view CurrentView) http.HandlerFunc {
@@ -0,0 +1,176 @@
+package gomek
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// defaultCipherSuites are the TLS 1.2 AEAD cipher suites with forward secrecy.
+// TLS 1.3 suites are not configurable & are always enabled.
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// certReloader holds the current certificate pair & reloads it from disk
+// when the process receives a SIGHUP
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	signals  chan os.Signal
+	done     chan struct{}
+	closed   sync.Once
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		signals:  make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	signal.Notify(c.signals, syscall.SIGHUP)
+	go c.watch()
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate %s: %w", c.certFile, err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) watch() {
+	for {
+		select {
+		case <-c.signals:
+			if err := c.reload(); err != nil {
+				// Keep serving the previous certificate
+				log.Println("[GOMEK] Error reloading certificate", err)
+				continue
+			}
+			out := PrintWithColor("[GOMEK] Reloaded TLS certificate", BLUE)
+			log.Printf(out)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// GetCertificate satisfies the `tls.Config.GetCertificate` callback
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Close stops watching for SIGHUP, it is safe to call more than once
+func (c *certReloader) Close() {
+	c.closed.Do(func() {
+		signal.Stop(c.signals)
+		close(c.done)
+	})
+}
+
+// closeCerts stops the certificate reloader, if there is one
+func (a *App) closeCerts() {
+	if a.certs != nil {
+		a.certs.Close()
+		a.certs = nil
+	}
+}
+
+func (a *App) tlsEnabled() bool {
+	return a.Config.TLSConfig != nil || (a.Config.TLSCertFile != "" && a.Config.TLSKeyFile != "")
+}
+
+// setupTLS configures a.server for HTTPS if `Config.TLSConfig` or the certificate
+// files are set. A user supplied `tls.Config` is cloned & never lowered below TLS 1.2.
+func (a *App) setupTLS() error {
+	if !a.tlsEnabled() {
+		return nil
+	}
+	var tlsConfig *tls.Config
+	if a.Config.TLSConfig != nil {
+		tlsConfig = a.Config.TLSConfig.Clone()
+		if tlsConfig.MinVersion < tls.VersionTLS12 {
+			tlsConfig.MinVersion = tls.VersionTLS12
+		}
+	} else {
+		tlsConfig = &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			CipherSuites:     defaultCipherSuites,
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		}
+	}
+	if a.Config.TLSCertFile != "" && a.Config.TLSKeyFile != "" {
+		certs, err := newCertReloader(a.Config.TLSCertFile, a.Config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		a.certs = certs
+		tlsConfig.GetCertificate = certs.GetCertificate
+	}
+	a.server.TLSConfig = tlsConfig
+	a.Protocol = "https"
+	if a.Config.HTTPRedirectPort != 0 {
+		// The handler is set once the listeners, & so the HTTPS port, are known
+		a.redirectServer = &http.Server{
+			Addr:              net.JoinHostPort(a.Host, strconv.Itoa(a.Config.HTTPRedirectPort)),
+			ReadTimeout:       limit(a.Config.ReadTimeout),
+			ReadHeaderTimeout: limit(a.Config.ReadHeaderTimeout),
+			WriteTimeout:      limit(a.Config.WriteTimeout),
+			IdleTimeout:       limit(a.Config.IdleTimeout),
+			MaxHeaderBytes:    limit(a.Config.MaxHeaderBytes),
+		}
+	}
+	return nil
+}
+
+// httpsPort is the port of the first TCP listener, e.g. one set with `ListenAddr`,
+// or fallback when the app only listens on Unix sockets
+func httpsPort(listeners []net.Listener, fallback int) int {
+	for _, l := range listeners {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
+	}
+	return fallback
+}
+
+// redirectToHTTPS permanently redirects every request to the same host & path on
+// the HTTPS port
+func redirectToHTTPS(port int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
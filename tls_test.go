@@ -0,0 +1,222 @@
+package gomek
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 to dir
+func writeTestCert(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestApp_RunTLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "gomek")
+	app := New(Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	app.SetHost("127.0.0.1")
+	app.Listen(freePort(t))
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		JSON(w, map[string]string{"name": "Joe"}, http.StatusOK)
+	}).Methods("GET")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-runErr
+		// e.g. a deferred Shutdown in the caller
+		if err := app.Shutdown(); err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	}()
+	addr := fmt.Sprintf("127.0.0.1:%d", app.Port)
+	waitForServer(t, addr)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11},
+	}}
+	if _, err := client.Get("https://" + addr + "/"); err == nil {
+		t.Errorf("expected TLS 1.1 to be rejected")
+	}
+
+	client = &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d got %d", http.StatusOK, resp.StatusCode)
+	}
+	if app.Protocol != "https" {
+		t.Errorf("expected https got %s", app.Protocol)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer certs.Close()
+	defer certs.Close()
+
+	writeTestCert(t, dir, "second")
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	for i := 0; i < 100; i++ {
+		cert, _ := certs.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if leaf.Subject.CommonName == "second" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected certificate to be reloaded on SIGHUP")
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	handler := redirectToHTTPS(8443)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/blogs?id=1", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("expected %d got %d", http.StatusMovedPermanently, resp.StatusCode)
+	}
+	expected := "https://example.com:8443/blogs?id=1"
+	if location := resp.Header.Get("Location"); location != expected {
+		t.Errorf("expected %s got %s", expected, location)
+	}
+}
+
+func TestApp_RunTLSRedirectListenAddr(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "gomek")
+	redirectPort := freePort(t)
+	app := New(Config{TLSCertFile: certFile, TLSKeyFile: keyFile, HTTPRedirectPort: redirectPort})
+	app.SetHost("127.0.0.1")
+	tlsPort := freePort(t)
+	app.ListenAddr(fmt.Sprintf("127.0.0.1:%d", tlsPort))
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-runErr
+	}()
+	redirectAddr := fmt.Sprintf("127.0.0.1:%d", redirectPort)
+	waitForServer(t, redirectAddr)
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get("http://" + redirectAddr + "/blogs")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	resp.Body.Close()
+	expected := fmt.Sprintf("https://127.0.0.1:%d/blogs", tlsPort)
+	if location := resp.Header.Get("Location"); location != expected {
+		t.Errorf("expected %s got %s", expected, location)
+	}
+}
+
+func TestStartServerRedirectPortTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer taken.Close()
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "gomek")
+	app := New(Config{TLSCertFile: certFile, TLSKeyFile: keyFile, HTTPRedirectPort: taken.Addr().(*net.TCPAddr).Port})
+	app.SetHost("127.0.0.1")
+	addr := "127.0.0.1:" + strconv.Itoa(freePort(t))
+	app.ListenAddr(addr)
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	if _, err := app.startServer(); err == nil {
+		t.Fatalf("expected the redirect listener to fail")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("expected %s to be closed", addr)
+	}
+	if app.certs != nil {
+		t.Errorf("expected the certificate reloader to be closed")
+	}
+}
+
+func TestStartServerClosesCerts(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "gomek")
+	app := New(Config{TLSCertFile: certFile, TLSKeyFile: keyFile})
+	app.ListenAddr("unix:" + filepath.Join(t.TempDir(), "missing", "app.sock"))
+	app.Route("/").View(func(w http.ResponseWriter, r *http.Request, d *Data) {}).Methods("GET")
+	if _, err := app.startServer(); err == nil {
+		t.Fatalf("expected the listener to fail")
+	}
+	if app.certs != nil {
+		t.Errorf("expected the certificate reloader to be closed")
+	}
+}
@@ -0,0 +1,567 @@
+package gomek
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TRACEPARENT_HEADER = "traceparent"
+	TRACESTATE_HEADER  = "tracestate"
+	// Response header holding the request's trace ID, also shown in logs & error pages
+	TRACE_ID_HEADER = "X-Trace-Id"
+	// Longest tracestate that is propagated, longer values are dropped
+	MAX_TRACESTATE_LENGTH = 512
+
+	DEFAULT_OTLP_ENDPOINT       = "http://localhost:4318/v1/traces"
+	DEFAULT_OTLP_SERVICE_NAME   = "gomek"
+	DEFAULT_OTLP_BATCH_SIZE     = 512
+	DEFAULT_OTLP_FLUSH_INTERVAL = 5 * time.Second
+	DEFAULT_OTLP_TIMEOUT        = 10 * time.Second
+)
+
+// SpanKind matches the OTLP span kinds
+type SpanKind int
+
+const (
+	SPAN_KIND_INTERNAL SpanKind = 1
+	SPAN_KIND_SERVER   SpanKind = 2
+)
+
+// Span is a timed operation within a trace, e.g. handling a request or executing a template
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	TraceState   string
+	Sampled      bool
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Err          error
+
+	mu       sync.Mutex
+	exporter SpanExporter
+	ended    bool
+}
+
+// SpanExporter sends finished spans to a tracing backend. Only sampled spans are exported.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+}
+
+// SetAttribute records a string, bool, int or float64 value on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Err = err
+	s.mu.Unlock()
+}
+
+// End finishes the span & exports it. Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	if !s.Sampled || s.exporter == nil {
+		return
+	}
+	if err := s.exporter.ExportSpans(context.Background(), []*Span{s}); err != nil {
+		log.Println("[GOMEK] Error exporting spans:", err)
+	}
+}
+
+// Traceparent formats the span as a W3C traceparent header value
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + flags
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	for {
+		rand.Read(b)
+		// All zero IDs are invalid
+		if !bytes.Equal(b, make([]byte, size)) {
+			return hex.EncodeToString(b)
+		}
+	}
+}
+
+func newSpan(name string, kind SpanKind, parent *Span) *Span {
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		SpanID:     newID(8),
+		StartTime:  time.Now(),
+		Attributes: map[string]interface{}{},
+	}
+	if parent != nil {
+		s.TraceID = parent.TraceID
+		s.ParentSpanID = parent.SpanID
+		s.TraceState = parent.TraceState
+		s.Sampled = parent.Sampled
+		s.exporter = parent.exporter
+	}
+	return s
+}
+
+var (
+	traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	spanIDPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	hexBytePattern = regexp.MustCompile(`^[0-9a-f]{2}$`)
+)
+
+// parseTraceparent parses a W3C traceparent header into the remote parent span
+func parseTraceparent(value string) (*Span, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return nil, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	// Version 00 has exactly 4 fields, later versions may append more
+	if !hexBytePattern.MatchString(version) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return nil, false
+	}
+	if !traceIDPattern.MatchString(traceID) || traceID == strings.Repeat("0", 32) {
+		return nil, false
+	}
+	if !spanIDPattern.MatchString(spanID) || spanID == strings.Repeat("0", 16) {
+		return nil, false
+	}
+	if !hexBytePattern.MatchString(flags) {
+		return nil, false
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return &Span{TraceID: traceID, SpanID: spanID, Sampled: f&1 == 1}, true
+}
+
+// SpanFromRequest returns the request's current span, or nil when the request isn't traced
+func SpanFromRequest(r *http.Request) *Span {
+	span, _ := r.Context().Value(spanKey).(*Span)
+	return span
+}
+
+// TraceID returns the request's trace ID, or "" when the request isn't traced
+func TraceID(r *http.Request) string {
+	if span := SpanFromRequest(r); span != nil {
+		return span.TraceID
+	}
+	return ""
+}
+
+// StartSpan starts a child of the request's current span. Use the returned request
+// so work done with it is nested under the new span. Spans are nil, & safe to use,
+// when the request isn't traced.
+//
+//	span, r := gomek.StartSpan(r, "load notices")
+//	defer span.End()
+func StartSpan(r *http.Request, name string) (*Span, *http.Request) {
+	parent := SpanFromRequest(r)
+	if parent == nil {
+		return nil, r
+	}
+	span := newSpan(name, SPAN_KIND_INTERNAL, parent)
+	return span, r.WithContext(context.WithValue(r.Context(), spanKey, span))
+}
+
+// InjectTrace adds the traceparent & tracestate headers of the request's current span
+// to header, so downstream services join the trace
+//
+//	req, _ := http.NewRequest("GET", "http://users/api/users", nil)
+//	gomek.InjectTrace(r, req.Header)
+func InjectTrace(r *http.Request, header http.Header) {
+	span := SpanFromRequest(r)
+	if span == nil {
+		return
+	}
+	header.Set(TRACEPARENT_HEADER, span.Traceparent())
+	if span.TraceState != "" {
+		header.Set(TRACESTATE_HEADER, span.TraceState)
+	}
+}
+
+// Tracing creates a span for each request, continuing the trace of an incoming
+// traceparent header, & child spans for middleware, views & templates. The trace
+// ID is sent in the `X-Trace-Id` header & shown in `Logging` & error pages.
+// Finished, sampled spans are sent to exporter, which may be nil.
+//
+//	exporter := gomek.NewOTLPExporter(gomek.OTLPOptions{ServiceName: "notices"})
+//	app.OnShutdown(exporter.Shutdown)
+//	app.Use(gomek.Tracing(exporter))
+//
+// Register `Tracing` after your other middleware so it wraps them.
+func Tracing(exporter SpanExporter) func(next http.Handler) http.HandlerFunc {
+	return func(next http.Handler) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if SpanFromRequest(r) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := RoutePattern(r)
+			name := r.Method
+			if route != "" {
+				name += " " + route
+			}
+			span := newSpan(name, SPAN_KIND_SERVER, nil)
+			span.exporter = exporter
+			if parent, ok := parseTraceparent(r.Header.Get(TRACEPARENT_HEADER)); ok {
+				span.TraceID = parent.TraceID
+				span.ParentSpanID = parent.SpanID
+				span.Sampled = parent.Sampled
+				if state := strings.TrimSpace(r.Header.Get(TRACESTATE_HEADER)); len(state) <= MAX_TRACESTATE_LENGTH {
+					span.TraceState = state
+				}
+			} else {
+				span.TraceID = newID(16)
+				span.Sampled = true
+			}
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("url.path", r.URL.Path)
+			span.SetAttribute("client.address", ClientIP(r))
+			if route != "" {
+				span.SetAttribute("http.route", route)
+			}
+			w.Header().Set(TRACE_ID_HEADER, span.TraceID)
+
+			sw := newStatusWriter(w)
+			defer func() {
+				status := sw.Status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if rec := recover(); rec != nil {
+					span.SetError(fmt.Errorf("panic: %v", rec))
+					span.End()
+					panic(rec)
+				}
+				span.SetAttribute("http.response.status_code", status)
+				if status >= 500 {
+					span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+				}
+				span.End()
+			}()
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), spanKey, span)))
+		})
+	}
+}
+
+var funcSuffixPattern = regexp.MustCompile(`(\.func\d+)+$`)
+
+// middlewareName names a middleware after its function, e.g. "gomek.Logging"
+func middlewareName(m func(http.Handler) http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(m).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	return funcSuffixPattern.ReplaceAllString(name, "")
+}
+
+// traceMiddleware runs m inside a span when the request is traced
+func traceMiddleware(m func(http.Handler) http.HandlerFunc) func(http.Handler) http.HandlerFunc {
+	name := "middleware " + middlewareName(m)
+	return func(next http.Handler) http.HandlerFunc {
+		handler := m(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			span, r := StartSpan(r, name)
+			defer span.End()
+			handler(w, r)
+		}
+	}
+}
+
+// responseTraceID is the trace ID set on the response by `Tracing`
+func responseTraceID(w http.ResponseWriter) string {
+	return w.Header().Get(TRACE_ID_HEADER)
+}
+
+// InMemoryExporter keeps exported spans in memory, for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpans stores the spans
+func (e *InMemoryExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+// Spans returns the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// OTLPOptions configure an `OTLPExporter`
+type OTLPOptions struct {
+	// Collector URL, defaults to DEFAULT_OTLP_ENDPOINT
+	Endpoint string
+	// service.name resource attribute, defaults to DEFAULT_OTLP_SERVICE_NAME
+	ServiceName string
+	// Extra request headers, e.g. an API key
+	Headers map[string]string
+	// Defaults to a client with DEFAULT_OTLP_TIMEOUT
+	Client *http.Client
+	// Spans are sent once this many are buffered or after FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector using OTLP/JSON over HTTP
+type OTLPExporter struct {
+	opts  OTLPOptions
+	mu    sync.Mutex
+	spans []*Span
+	timer *time.Timer
+}
+
+// NewOTLPExporter creates an `OTLPExporter`, call `Shutdown` to send the remaining spans
+//
+//	exporter := gomek.NewOTLPExporter(gomek.OTLPOptions{
+//		Endpoint:    "http://collector:4318/v1/traces",
+//		ServiceName: "notices",
+//	})
+func NewOTLPExporter(opts OTLPOptions) *OTLPExporter {
+	if opts.Endpoint == "" {
+		opts.Endpoint = DEFAULT_OTLP_ENDPOINT
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DEFAULT_OTLP_SERVICE_NAME
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DEFAULT_OTLP_TIMEOUT}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DEFAULT_OTLP_BATCH_SIZE
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DEFAULT_OTLP_FLUSH_INTERVAL
+	}
+	return &OTLPExporter{opts: opts}
+}
+
+// ExportSpans buffers the spans, they are sent in the background
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	if len(e.spans) >= e.opts.BatchSize {
+		go e.flushInBackground()
+	} else if e.timer == nil {
+		e.timer = time.AfterFunc(e.opts.FlushInterval, e.flushInBackground)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) flushInBackground() {
+	if err := e.Flush(context.Background()); err != nil {
+		log.Println("[GOMEK] Error exporting spans:", err)
+	}
+}
+
+// Flush sends the buffered spans
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("gomek: OTLP endpoint returned %s", res.Status)
+	}
+	return nil
+}
+
+// Shutdown sends the buffered spans, use it as an `OnShutdown` hook
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return e.Flush(ctx)
+}
+
+// OTLP/JSON request types, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		i := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &i}
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &i}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	}
+	s := fmt.Sprint(value)
+	return otlpAnyValue{StringValue: &s}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var kvs []otlpKeyValue
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpValue(attributes[k])})
+	}
+	return kvs
+}
+
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	var out []otlpSpan
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			TraceState:        s.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.Err != nil {
+			// STATUS_CODE_ERROR
+			span.Status = otlpStatus{Code: 2, Message: s.Err.Error()}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(map[string]interface{}{
+			"service.name": e.opts.ServiceName,
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "gomek"},
+			Spans: out,
+		}},
+	}}}
+}
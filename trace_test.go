@@ -0,0 +1,263 @@
+package gomek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{testTraceparent, true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		span, ok := parseTraceparent(test.value)
+		if ok != test.ok {
+			t.Errorf("%q: expected %v got %v", test.value, test.ok, ok)
+			continue
+		}
+		if ok && span.Sampled != test.sampled {
+			t.Errorf("%q: expected sampled %v got %v", test.value, test.sampled, span.Sampled)
+		}
+	}
+}
+
+func newTracedApp(t *testing.T, exporter SpanExporter) http.Handler {
+	layout := filepath.Join(t.TempDir(), "layout.gohtml")
+	if err := os.WriteFile(layout, []byte(`{{ define "layout" }}{{ traceID }}{{ end }}`), 0600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	app := New(Config{})
+	app.Use(Metrics())
+	app.Use(Tracing(exporter))
+	app.Route("/notices/<id>").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		span, _ := StartSpan(r, "load notice")
+		span.SetAttribute("notice.id", Args(r)["id"])
+		span.End()
+	}).Methods("GET").Templates(layout)
+	return app.setup().Handler
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	handler := newTracedApp(t, exporter)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/notices/1", nil)
+	req.Header.Set(TRACEPARENT_HEADER, testTraceparent)
+	req.Header.Set(TRACESTATE_HEADER, "vendor=abc")
+	handler.ServeHTTP(w, req)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	if header := w.Header().Get(TRACE_ID_HEADER); header != traceID {
+		t.Errorf("expected %s got %s", traceID, header)
+	}
+	if w.Body.String() != traceID {
+		t.Errorf("expected the traceID template function to render %s got %s", traceID, w.Body.String())
+	}
+	spans := map[string]*Span{}
+	for _, span := range exporter.Spans() {
+		if span.TraceID != traceID || span.TraceState != "vendor=abc" {
+			t.Errorf("expected %s vendor=abc got %s %s", traceID, span.TraceID, span.TraceState)
+		}
+		spans[span.Name] = span
+	}
+	server := spans["GET /notices/<id>"]
+	if server == nil || server.Kind != SPAN_KIND_SERVER {
+		t.Fatalf("expected a server span got %v", spans)
+	}
+	if server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the incoming span as parent got %s", server.ParentSpanID)
+	}
+	if server.Attributes["http.response.status_code"] != http.StatusOK {
+		t.Errorf("expected 200 got %v", server.Attributes["http.response.status_code"])
+	}
+	// Each span is a child of the one before it, Metrics was registered before
+	// Tracing so it runs inside the request span
+	parent := server
+	for _, name := range []string{"middleware gomek.Metrics", "view /notices/<id>", "load notice"} {
+		span := spans[name]
+		if span == nil {
+			t.Fatalf("expected a %s span got %v", name, spans)
+		}
+		if span.ParentSpanID != parent.SpanID {
+			t.Errorf("expected %s to be a child of %s", name, parent.Name)
+		}
+		parent = span
+	}
+	if template := spans["template layout.gohtml"]; template == nil || template.ParentSpanID != spans["view /notices/<id>"].ParentSpanID {
+		t.Errorf("expected a template span beside the view span got %v", spans)
+	}
+	if spans["load notice"].Attributes["notice.id"] != "1" {
+		t.Errorf("expected notice.id 1 got %v", spans["load notice"].Attributes)
+	}
+}
+
+func TestTracingUnsampled(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	handler := newTracedApp(t, exporter)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/notices/1", nil)
+	req.Header.Set(TRACEPARENT_HEADER, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	handler.ServeHTTP(w, req)
+	if len(exporter.Spans()) != 0 {
+		t.Errorf("expected no spans got %d", len(exporter.Spans()))
+	}
+	if w.Header().Get(TRACE_ID_HEADER) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace to be continued got %s", w.Header().Get(TRACE_ID_HEADER))
+	}
+
+	// Without a traceparent a new trace is started
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/notices/1", nil))
+	traceID := w.Header().Get(TRACE_ID_HEADER)
+	if len(traceID) != 32 || traceID == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected a new trace ID got %s", traceID)
+	}
+	if len(exporter.Spans()) == 0 {
+		t.Errorf("expected new traces to be sampled")
+	}
+}
+
+func TestTracingErrorPage(t *testing.T) {
+	handler := newTracedApp(t, nil)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if problem["traceId"] == nil || problem["traceId"] != w.Header().Get(TRACE_ID_HEADER) {
+		t.Errorf("expected the trace ID in %v", problem)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/html")
+	handler.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "Trace ID: "+w.Header().Get(TRACE_ID_HEADER)) {
+		t.Errorf("expected the trace ID in %s", w.Body.String())
+	}
+}
+
+func TestInjectTrace(t *testing.T) {
+	handler := Tracing(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, r := StartSpan(r, "call users")
+		header := http.Header{}
+		InjectTrace(r, header)
+		expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanID + "-01"
+		if header.Get(TRACEPARENT_HEADER) != expected {
+			t.Errorf("expected %s got %s", expected, header.Get(TRACEPARENT_HEADER))
+		}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(TRACEPARENT_HEADER, testTraceparent)
+	handler(httptest.NewRecorder(), req)
+
+	// Untraced requests are left alone
+	header := http.Header{}
+	span, r := StartSpan(httptest.NewRequest("GET", "/", nil), "untraced")
+	span.End()
+	InjectTrace(r, header)
+	if span != nil || header.Get(TRACEPARENT_HEADER) != "" {
+		t.Errorf("expected no span & no header got %v %v", span, header)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Api-Key") != "secret" {
+			t.Errorf("expected JSON & the API key got %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+	exporter := NewOTLPExporter(OTLPOptions{
+		Endpoint:    server.URL,
+		ServiceName: "notices",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		BatchSize:   2,
+	})
+
+	parent, _ := parseTraceparent(testTraceparent)
+	span := newSpan("GET /notices", SPAN_KIND_SERVER, parent)
+	span.exporter = exporter
+	span.SetAttribute("http.response.status_code", 500)
+	span.SetError(errors.New("boom"))
+	span.End()
+	span.End()
+	newSpan("template layout.gohtml", SPAN_KIND_INTERNAL, span).End()
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a full batch to be sent")
+	}
+	var req otlpRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	resource := req.ResourceSpans[0]
+	if *resource.Resource.Attributes[0].Value.StringValue != "notices" {
+		t.Errorf("expected service.name notices got %s", body)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans got %s", body)
+	}
+	exported := spans[0]
+	if exported.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || exported.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the trace & parent IDs got %s", body)
+	}
+	if exported.Kind != SPAN_KIND_SERVER || exported.Status.Code != 2 || exported.Status.Message != "boom" {
+		t.Errorf("expected an errored server span got %s", body)
+	}
+	if *exported.Attributes[0].Value.IntValue != "500" {
+		t.Errorf("expected an int attribute got %s", body)
+	}
+	if !strings.Contains(string(body), `"startTimeUnixNano":"`) {
+		t.Errorf("expected string encoded timestamps got %s", body)
+	}
+	// Shutdown sends what is left of a batch
+	query := newSpan("query", SPAN_KIND_INTERNAL, span)
+	query.End()
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	select {
+	case body = <-bodies:
+		if !strings.Contains(string(body), `"name":"query"`) {
+			t.Errorf("expected the remaining span got %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected Shutdown to send the remaining span")
+	}
+}
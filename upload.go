@@ -0,0 +1,241 @@
+package gomek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Largest upload accepted by a route without its own `UploadOptions.MaxSize`
+	DEFAULT_MAX_UPLOAD_SIZE = 10 << 20 // 10 MB
+	// Longest filename kept by `SafeFilename`
+	MAX_FILENAME_LENGTH = 255
+	// Bytes read to sniff an upload's MIME type, see `http.DetectContentType`
+	sniffLength = 512
+)
+
+// ErrUnsupportedMediaType is returned by `Files` when an upload's sniffed MIME
+// type isn't in the route's `UploadOptions.AllowedTypes`
+var ErrUnsupportedMediaType = errors.New("gomek: unsupported media type")
+
+// UploadOptions limits the files a route accepts, see `App.Uploads`
+type UploadOptions struct {
+	// MaxSize is the largest request body & file the route accepts. Replaces
+	// `Config.MaxBodyBytes` for the route. Defaults to `DEFAULT_MAX_UPLOAD_SIZE`.
+	MaxSize int64
+	// AllowedTypes are the sniffed MIME types accepted, e.g. "image/png" or
+	// "image/*". Any type is accepted when empty.
+	AllowedTypes []string
+}
+
+// Upload is a file from a `multipart/form-data` request. Its contents are
+// stored in a temporary file that is removed once the request has finished.
+type Upload struct {
+	// Filename is the client's filename made safe with `SafeFilename`
+	Filename string
+	// Size in bytes
+	Size int64
+	// ContentType is sniffed from the file's contents, the client's
+	// Content-Type header is ignored
+	ContentType string
+	Header      *multipart.FileHeader
+}
+
+// Uploads sets the upload limits for the current route's view. Files larger than
+// MaxSize are rejected with a 413 & types not in AllowedTypes with a 415
+// when read with `Files`.
+//
+//	app.Route("/avatar").View(avatar).Methods("POST").Uploads(gomek.UploadOptions{
+//		MaxSize:      2 << 20,
+//		AllowedTypes: []string{"image/png", "image/jpeg"},
+//	})
+func (a *App) Uploads(opts UploadOptions) *App {
+	a.currentUploads = &opts
+	return a
+}
+
+// setUploadOptions adds the route's upload options to the request context
+func setUploadOptions(r *http.Request, opts *UploadOptions) *http.Request {
+	ctx := context.WithValue(r.Context(), uploadsKey, opts)
+	return r.WithContext(ctx)
+}
+
+// withDefaults returns a copy of o with zero values replaced by their defaults
+func (o *UploadOptions) withDefaults() UploadOptions {
+	opts := UploadOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DEFAULT_MAX_UPLOAD_SIZE
+	}
+	return opts
+}
+
+func uploadOptions(r *http.Request) UploadOptions {
+	o, _ := r.Context().Value(uploadsKey).(*UploadOptions)
+	return o.withDefaults()
+}
+
+// Files returns the uploads sent in the form field name. Files are streamed to
+// temporary files rather than held in memory. `http.ErrMissingFile` is returned
+// if no files were sent, `ErrBodyTooLarge` or `ErrUnsupportedMediaType` if a file
+// breaks the route's `UploadOptions`. All can be passed to `gomek.Error`.
+//
+//	func Avatar(w http.ResponseWriter, r *http.Request, d *gomek.Data) {
+//		uploads, err := gomek.Files(r, "avatar")
+//		if err != nil {
+//			gomek.Error(w, err)
+//			return
+//		}
+//		path, err := uploads[0].SaveTo("./uploads")
+//	}
+func Files(r *http.Request, name string) ([]Upload, error) {
+	if r.MultipartForm == nil {
+		// No memory is used for files so every file part is written to disk
+		if err := r.ParseMultipartForm(0); err != nil {
+			if isBodyTooLarge(err) {
+				return nil, ErrBodyTooLarge
+			}
+			return nil, fmt.Errorf("%w: %s", ErrInvalidBody, err)
+		}
+	}
+	headers := r.MultipartForm.File[name]
+	if len(headers) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	opts := uploadOptions(r)
+	uploads := make([]Upload, 0, len(headers))
+	for _, header := range headers {
+		if opts.MaxSize > 0 && header.Size > opts.MaxSize {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrBodyTooLarge, SafeFilename(header.Filename), opts.MaxSize)
+		}
+		contentType, err := sniffContentType(header)
+		if err != nil {
+			return nil, err
+		}
+		if !allowedType(contentType, opts.AllowedTypes) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+		}
+		uploads = append(uploads, Upload{
+			Filename:    SafeFilename(header.Filename),
+			Size:        header.Size,
+			ContentType: contentType,
+			Header:      header,
+		})
+	}
+	return uploads, nil
+}
+
+func sniffContentType(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	contentType := http.DetectContentType(buf[:n])
+	// Drop parameters such as "; charset=utf-8"
+	if i := strings.Index(contentType, ";"); i != -1 {
+		contentType = contentType[:i]
+	}
+	return contentType, nil
+}
+
+func allowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == contentType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// SafeFilename strips any directories from a client supplied filename & replaces
+// characters other than letters, digits, '.', '-' & '_' with '_'
+//
+//	gomek.SafeFilename("../../etc/pass wd") // "pass_wd"
+func SafeFilename(name string) string {
+	// Clients may send Windows paths
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(name)
+	if name == "/" {
+		name = ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, name)
+	// Hidden files & "." or ".." aren't allowed
+	name = strings.TrimLeft(name, ".")
+	if len(name) > MAX_FILENAME_LENGTH {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = name[:MAX_FILENAME_LENGTH-len(ext)] + ext
+	}
+	if name == "" {
+		name = "upload"
+	}
+	return name
+}
+
+// Open returns the upload's contents
+func (u Upload) Open() (multipart.File, error) {
+	return u.Header.Open()
+}
+
+// SaveTo copies the upload into dir as `Filename` & returns its path. The name is
+// made safe again so it can't escape dir, an existing file is never overwritten.
+//
+//	path, err := upload.SaveTo("./uploads")
+func (u Upload) SaveTo(dir string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, SafeFilename(u.Filename))
+	if rel, err := filepath.Rel(root, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("gomek: invalid upload filename %q", u.Filename)
+	}
+	src, err := u.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
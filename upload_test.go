@@ -0,0 +1,140 @@
+package gomek
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+func newUploadRequest(t *testing.T, field string, filename string, content []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	part.Write(content)
+	writer.WriteField("title", "avatar")
+	writer.Close()
+	req := httptest.NewRequest("POST", "/avatar", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestFiles(t *testing.T) {
+	req := newUploadRequest(t, "avatar", `..\..\my avatar.png`, testPNG)
+	uploads, err := Files(req, "avatar")
+	if err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	if len(uploads) != 1 {
+		t.Fatalf("Expected 1 upload got %d", len(uploads))
+	}
+	u := uploads[0]
+	if u.Filename != "my_avatar.png" || u.Size != int64(len(testPNG)) || u.ContentType != "image/png" {
+		t.Errorf("Unexpected upload %+v", u)
+	}
+	// Streamed to disk rather than held in memory
+	for _, h := range req.MultipartForm.File["avatar"] {
+		f, _ := h.Open()
+		if _, ok := f.(*os.File); !ok {
+			t.Errorf("Expected the upload to be stored in a temporary file got %T", f)
+		}
+		f.Close()
+	}
+	req.MultipartForm.RemoveAll()
+
+	if _, err := Files(newUploadRequest(t, "avatar", "a.png", testPNG), "missing"); !errors.Is(err, http.ErrMissingFile) {
+		t.Errorf("Expected ErrMissingFile got %v", err)
+	}
+}
+
+func TestSafeFilename(t *testing.T) {
+	tests := map[string]string{
+		"../../etc/passwd":       "passwd",
+		`C:\Users\joe\photo.jpg`: "photo.jpg",
+		"..":                     "upload",
+		".htaccess":              "htaccess",
+		"résumé 2024.pdf":        "r_sum__2024.pdf",
+		"":                       "upload",
+		"/":                      "upload",
+		"report\x00.pdf":         "report_.pdf",
+		string(bytes.Repeat([]byte("a"), 300)) + ".txt": string(bytes.Repeat([]byte("a"), 251)) + ".txt",
+	}
+	for name, expected := range tests {
+		if got := SafeFilename(name); got != expected {
+			t.Errorf("SafeFilename(%q): expected %q got %q", name, expected, got)
+		}
+	}
+}
+
+func TestUploadSaveTo(t *testing.T) {
+	dir := t.TempDir()
+	req := newUploadRequest(t, "avatar", "avatar.png", testPNG)
+	uploads, err := Files(req, "avatar")
+	if err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	defer req.MultipartForm.RemoveAll()
+	upload := uploads[0]
+	path, err := upload.SaveTo(dir)
+	if err != nil {
+		t.Fatalf("Expected nil got %v", err)
+	}
+	if path != filepath.Join(dir, "avatar.png") {
+		t.Errorf("Expected the file in %s got %s", dir, path)
+	}
+	if saved, _ := os.ReadFile(path); !bytes.Equal(saved, testPNG) {
+		t.Errorf("Expected the saved file to match the upload")
+	}
+	// Existing files are not overwritten
+	if _, err := upload.SaveTo(dir); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected ErrExist got %v", err)
+	}
+	// Filenames changed after Files are made safe again
+	upload.Filename = "../../escape.png"
+	path, err = upload.SaveTo(dir)
+	if err != nil || path != filepath.Join(dir, "escape.png") {
+		t.Errorf("Expected the file to stay in %s got %s %v", dir, path, err)
+	}
+}
+
+func TestUploadsRoute(t *testing.T) {
+	app := New(Config{})
+	app.Route("/avatar").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		uploads, err := Files(r, "avatar")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		w.Write([]byte(uploads[0].ContentType))
+	}).Methods("POST").Uploads(UploadOptions{
+		MaxSize:      1024,
+		AllowedTypes: []string{"image/*"},
+	})
+	handler := app.setup().Handler
+
+	tests := []struct {
+		name    string
+		content []byte
+		status  int
+	}{
+		{"allowed", testPNG, http.StatusOK},
+		{"wrong type", []byte("plain text"), http.StatusUnsupportedMediaType},
+		{"too large", append(testPNG, make([]byte, 2048)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, newUploadRequest(t, "avatar", "avatar.png", tt.content))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d got %d %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package gomek
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by `Validate` & the bind functions when one or
+// more fields fail their `validate` struct tag rules. It marshals to JSON as
+//
+//	{"errors": [{"field": "email", "rule": "email", "message": "must be a valid email address"}]}
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (v *ValidationError) Error() string {
+	var messages []string
+	for _, e := range v.Errors {
+		messages = append(messages, e.Field+" "+e.Message)
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// Fields returns the first message for each invalid field, keyed by field name
+func (v *ValidationError) Fields() map[string]string {
+	fields := map[string]string{}
+	for _, e := range v.Errors {
+		if _, ok := fields[e.Field]; !ok {
+			fields[e.Field] = e.Message
+		}
+	}
+	return fields
+}
+
+// Validate checks the `validate` struct tag rules of v, which must be a struct or
+// a pointer to a struct. Rules are comma separated:
+//
+//	required    the field must not be its zero value
+//	min=n       minimum length of a string, slice or map, or minimum value of a number
+//	max=n       maximum length of a string, slice or map, or maximum value of a number
+//	len=n       exact length of a string, slice or map
+//	email       a valid email address
+//	url         an absolute URL
+//	oneof=a b   one of the space separated values
+//
+// Rules apply to zero values, so `validate:"min=18"` rejects an age of 0. Use a
+// pointer for an optional field, its rules are skipped when it is nil. Empty strings
+// pass `email`, `url` & `oneof`.
+//
+// Nested structs & slices of structs are validated too. Field names are taken from
+// the `json` tag. A `*ValidationError` is returned if any field is invalid.
+//
+//	type User struct {
+//		Name  string `json:"name" validate:"required,min=3"`
+//		Email string `json:"email" validate:"required,email"`
+//	}
+func Validate(v interface{}) error {
+	return validate(v, "json")
+}
+
+// validate checks v, naming the fields after nameTag
+func validate(v interface{}, nameTag string) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return fmt.Errorf("gomek: cannot validate a nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("gomek: cannot validate %T, expected a struct", v)
+	}
+	var verr ValidationError
+	if err := validateStruct(rv, "", nameTag, &verr); err != nil {
+		return err
+	}
+	if len(verr.Errors) > 0 {
+		return &verr
+	}
+	return nil
+}
+
+// fieldName returns the name of a field from its tag, or "" if the field is skipped
+func fieldName(f reflect.StructField, nameTag string) string {
+	name := strings.Split(f.Tag.Get(nameTag), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func validateStruct(rv reflect.Value, prefix string, nameTag string, verr *ValidationError) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := fieldName(f, nameTag)
+		if name == "" {
+			continue
+		}
+		name = prefix + name
+		fv := rv.Field(i)
+		if rules := f.Tag.Get("validate"); rules != "" {
+			failed, err := validateField(fv, name, rules, verr)
+			if err != nil {
+				return err
+			}
+			if failed {
+				continue
+			}
+		}
+		if err := validateNested(fv, name, nameTag, verr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates structs, pointers to structs & slices of structs
+func validateNested(fv reflect.Value, name string, nameTag string, verr *ValidationError) error {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		return validateStruct(fv, name+".", nameTag, verr)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := validateNested(fv.Index(i), fmt.Sprintf("%s[%d]", name, i), nameTag, verr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField applies each rule to fv & records the first failure
+func validateField(fv reflect.Value, name string, rules string, verr *ValidationError) (bool, error) {
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		param := ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			rule, param = rule[:i], rule[i+1:]
+		}
+		message, err := checkRule(fv, rule, param)
+		if err != nil {
+			return false, fmt.Errorf("gomek: field %s: %w", name, err)
+		}
+		if message != "" {
+			verr.Errors = append(verr.Errors, FieldError{Field: name, Rule: rule, Message: message})
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkRule returns a message if fv fails rule
+func checkRule(fv reflect.Value, rule string, param string) (string, error) {
+	if rule == "required" {
+		if fv.IsZero() {
+			return "is required", nil
+		}
+		return "", nil
+	}
+	// Optional pointer fields are only checked when set
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return "", nil
+		}
+		fv = fv.Elem()
+	}
+	// An empty string is an unset optional value, e.g. a blank form input
+	if (rule == "email" || rule == "url" || rule == "oneof") && fv.Kind() == reflect.String && fv.Len() == 0 {
+		return "", nil
+	}
+	switch rule {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s parameter %q", rule, param)
+		}
+		return checkSize(fv, rule, n)
+	case "email":
+		addr, err := mail.ParseAddress(fv.String())
+		if fv.Kind() != reflect.String || err != nil || addr.Address != fv.String() {
+			return "must be a valid email address", nil
+		}
+	case "url":
+		u, err := url.Parse(fv.String())
+		if fv.Kind() != reflect.String || err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid URL", nil
+		}
+	case "oneof":
+		value := fmt.Sprint(fv.Interface())
+		for _, option := range strings.Fields(param) {
+			if value == option {
+				return "", nil
+			}
+		}
+		return "must be one of " + strings.Join(strings.Fields(param), ", "), nil
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", rule)
+	}
+	return "", nil
+}
+
+func checkSize(fv reflect.Value, rule string, n float64) (string, error) {
+	var size float64
+	unit := ""
+	switch fv.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(fv.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size = float64(fv.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = fv.Float()
+	default:
+		return "", fmt.Errorf("rule %s does not support %s", rule, fv.Kind())
+	}
+	bound := strconv.FormatFloat(n, 'f', -1, 64)
+	switch {
+	case rule == "min" && size < n:
+		return "must be at least " + bound + unit, nil
+	case rule == "max" && size > n:
+		return "must be at most " + bound + unit, nil
+	case rule == "len" && size != n:
+		return "must be exactly " + bound + unit, nil
+	}
+	return "", nil
+}
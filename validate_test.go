@@ -0,0 +1,98 @@
+package gomek
+
+import (
+	"errors"
+	"testing"
+)
+
+type testAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type testUser struct {
+	Name      string        `json:"name" validate:"required,min=3,max=10"`
+	Email     string        `json:"email" validate:"required,email"`
+	Website   string        `json:"website" validate:"url"`
+	Role      string        `json:"role" validate:"oneof=admin editor"`
+	Age       *int          `json:"age" validate:"min=18"`
+	Address   testAddress   `json:"address"`
+	Addresses []testAddress `json:"addresses"`
+}
+
+func TestValidate(t *testing.T) {
+	age := 12
+	user := testUser{
+		Name:      "Jo",
+		Email:     "not-an-email",
+		Website:   "example.com",
+		Role:      "owner",
+		Age:       &age,
+		Addresses: []testAddress{{City: "London"}, {}},
+	}
+	err := Validate(&user)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError got %v", err)
+	}
+	expected := map[string]string{
+		"name":              "must be at least 3 characters",
+		"email":             "must be a valid email address",
+		"website":           "must be a valid URL",
+		"role":              "must be one of admin, editor",
+		"age":               "must be at least 18",
+		"address.city":      "is required",
+		"addresses[1].city": "is required",
+	}
+	fields := verr.Fields()
+	if len(fields) != len(expected) {
+		t.Errorf("Expected %d errors got %v", len(expected), fields)
+	}
+	for field, message := range expected {
+		if fields[field] != message {
+			t.Errorf("Expected %s %s got '%s'", field, message, fields[field])
+		}
+	}
+}
+
+func TestValidateOptionalFields(t *testing.T) {
+	user := testUser{
+		Name:    "Joe",
+		Email:   "joe@example.com",
+		Address: testAddress{City: "London"},
+	}
+	if err := Validate(user); err != nil {
+		t.Errorf("Expected nil got %v", err)
+	}
+}
+
+func TestValidateZeroValues(t *testing.T) {
+	v := struct {
+		Age   int    `json:"age" validate:"min=18"`
+		Name  string `json:"name" validate:"min=3"`
+		Email string `json:"email" validate:"email"`
+	}{}
+	err := Validate(v)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a *ValidationError got %v", err)
+	}
+	expected := map[string]string{
+		"age":  "must be at least 18",
+		"name": "must be at least 3 characters",
+	}
+	fields := verr.Fields()
+	if len(fields) != len(expected) || fields["age"] != expected["age"] || fields["name"] != expected["name"] {
+		t.Errorf("Expected %v got %v", expected, fields)
+	}
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	v := struct {
+		Name string `validate:"shiny"`
+	}{Name: "Joe"}
+	err := Validate(v)
+	var verr *ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Errorf("Expected an unknown rule error got %v", err)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type ViewTemplate struct {
@@ -22,6 +24,10 @@ type View struct {
 	Methods         []string
 	Templates       []string
 	View            CurrentView
+	Timeout         time.Duration
+	Uploads         *UploadOptions
+	Middleware      Middleware
+	Cache           func(http.Handler) http.HandlerFunc // innermost route middleware, see `App.Cache`
 	StoredViews     []View
 }
 
@@ -65,10 +71,21 @@ func (v *View) Create(a *App, view View) {
 	// Add middleware
 	var wrappedHandler http.HandlerFunc
 	wrappedHandler = v.handleFuncWrapper(finalTemplates, &a.Config, view, view.View)
+	if view.Timeout > 0 {
+		wrappedHandler = timeoutHandler(wrappedHandler, view.Timeout)
+	}
+	if view.Cache != nil {
+		wrappedHandler = traceMiddleware(view.Cache)(wrappedHandler)
+	}
+	// Route middleware runs inside the app's middleware, the first chained runs
+	// first so `.IPFilter(...).Cache(...)` filters before serving from the cache
+	for i := len(view.Middleware) - 1; i >= 0; i-- {
+		wrappedHandler = traceMiddleware(view.Middleware[i])(wrappedHandler)
+	}
 
 	for _, m := range a.middleware {
 		if m != nil {
-			wrappedHandler = m(wrappedHandler)
+			wrappedHandler = traceMiddleware(m)(wrappedHandler)
 		}
 	}
 
@@ -76,6 +93,8 @@ func (v *View) Create(a *App, view View) {
 	if wrappedHandler == nil {
 		wrappedHandler = v.handleFuncWrapper(finalTemplates, &a.Config, view, view.View)
 	}
+	// Request hooks run outside of all the middleware
+	wrappedHandler = a.wrapHooks(wrappedHandler)
 	// Create handler
 	a.Mux.HandleFunc(view.Route, wrappedHandler)
 }
@@ -130,13 +149,55 @@ func testMethod(r *http.Request, v View) bool {
 	return false
 }
 
+// timeoutHandler cancels the request context once d has elapsed. If the view
+// hasn't started its response a 503 is sent, otherwise the view keeps the
+// response it started. Responses aren't buffered so streaming & WebSockets work.
+func timeoutHandler(next http.Handler, d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		tw := &timeoutWriter{w: w, header: http.Header{}}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if rec := recover(); rec != nil {
+					panicked <- rec
+				}
+				close(done)
+			}()
+			// A clone so the view's request headers don't race with the 503
+			next.ServeHTTP(tw, r.Clone(ctx))
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			tw.mu.Lock()
+			started := tw.started
+			tw.timedOut = !started
+			tw.mu.Unlock()
+			if !started {
+				httpError(w, r, http.StatusServiceUnavailable, "the request timed out")
+				return
+			}
+			<-done
+		}
+		select {
+		case rec := <-panicked:
+			panic(rec)
+		default:
+		}
+	}
+}
+
 func (v *View) handleFuncWrapper(templates []string, config *Config, view View, currentView CurrentView) http.HandlerFunc {
-	var data Data
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
 			routeMatches  bool
 			methodMatches bool
 			vars          map[string]string
+			data          Data
+			form          *Form
 		)
 		// Route
 		if v, viewVars, ok := getView(r, view); ok {
@@ -150,15 +211,61 @@ func (v *View) handleFuncWrapper(templates []string, config *Config, view View,
 			methodMatches = testMethod(r, *v)
 		}
 		if !routeMatches || !methodMatches {
+			status, detail := http.StatusNotFound, "no route matches "+r.URL.Path
+			if routeMatches {
+				status, detail = http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path
+				w.Header().Set("Allow", strings.Join(view.Methods, ", "))
+			}
+			if len(templates) > 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			Problem(w, status, "", detail, nil)
 			return
 		}
+		// Limit the request body size, upload routes have their own limit
+		maxBodyBytes := config.MaxBodyBytes
+		if view.Uploads != nil {
+			maxBodyBytes = view.Uploads.withDefaults().MaxSize
+		}
+		if maxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		}
 		// set context
 		r = setViewVars(r, vars)
+		if view.Uploads != nil {
+			r = setUploadOptions(r, view.Uploads)
+		}
+		if len(templates) > 0 {
+			r, form = setFormHolder(r)
+		}
 		// Handler processes data only
-		currentView(w, r, &data)
+		viewSpan, viewRequest := StartSpan(r, "view "+view.pattern())
+		viewWriter := w
+		if config.Debug {
+			viewWriter = &debugWriter{w}
+		}
+		currentView(viewWriter, viewRequest, &data)
+		viewSpan.End()
+		// The server only removes temporary files for its own copy of the request
+		if viewRequest.MultipartForm != nil {
+			defer viewRequest.MultipartForm.RemoveAll()
+		}
 		// Add template(s) if they exist
 		if len(templates) > 0 {
-			te, err := template.ParseFiles(templates...)
+			// Expose the form bound by the view
+			if data == nil {
+				data = Data{}
+			}
+			if _, ok := data[FORM_DATA_KEY]; !ok {
+				data[FORM_DATA_KEY] = *form
+			}
+			start := time.Now()
+			templateSpan, r := StartSpan(r, "template "+filepath.Base(templates[0]))
+			te, err := template.New(filepath.Base(templates[0])).
+				Funcs(config.TemplateFuncs).
+				Funcs(requestTemplateFuncs(r)).
+				ParseFiles(templates...)
 			if err != nil {
 				out := fmt.Sprintf("[GOMEK]: Error parsing registeredTemplates: %v", err.Error())
 				out = PrintWithColor(out, RED)
@@ -167,7 +274,10 @@ func (v *View) handleFuncWrapper(templates []string, config *Config, view View,
 			err = te.ExecuteTemplate(w, config.BaseTemplateName, data)
 			if err != nil {
 				log.Printf("[GOMEK] Error: Error executing template!\n %e", err)
+				templateSpan.SetError(err)
 			}
+			templateSpan.End()
+			templateRenderDuration.Observe(time.Since(start).Seconds(), view.pattern())
 		} else {
 			// No registeredTemplates so treat as JSON / TEXT
 			r.Header.Set("Content-Type", "application/json")
@@ -175,6 +285,18 @@ func (v *View) handleFuncWrapper(templates []string, config *Config, view View,
 	}
 }
 
+// requestTemplateFuncs are the template functions bound to the current request
+func requestTemplateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string {
+			return CSPNonce(r)
+		},
+		"traceID": func() string {
+			return TraceID(r)
+		},
+	}
+}
+
 func (v *View) createHandlerFromResource(delete, get, post, put CurrentView) CurrentView {
 	// Creates a single handler with a switch to call each resource declared function
 	return func(w http.ResponseWriter, r *http.Request, d *Data) {
@@ -218,12 +340,24 @@ func (v *View) StoreResource(a *App) {
 	}
 }
 
+// pattern is the route the view was registered with
+func (v View) pattern() string {
+	if v.registeredRoute != "" {
+		return v.registeredRoute
+	}
+	return v.Route
+}
+
 func (v *View) Store(a *App) {
 	c := View{
-		Route:     a.currentRoute,
-		Methods:   a.currentMethods,
-		Templates: a.currentTemplates,
-		View:      a.currentView,
+		Route:      a.currentRoute,
+		Methods:    a.currentMethods,
+		Templates:  a.currentTemplates,
+		View:       a.currentView,
+		Timeout:    a.currentTimeout,
+		Uploads:    a.currentUploads,
+		Middleware: a.currentMiddleware,
+		Cache:      a.currentCache,
 	}
 	if a.currentRoute != "/" {
 		r := strings.Split(a.currentRoute, "/")
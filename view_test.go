@@ -1,10 +1,13 @@
 package gomek
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Notice struct{}
@@ -65,7 +68,7 @@ func TestViewGet(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	expected := `{"name":"Joe"}`
+	expected := `{"name":"Ram"}` + "\n"
 	if string(data) != expected {
 		t.Errorf("Expected %s got '%v'", expected, string(data))
 	}
@@ -91,7 +94,7 @@ func TestViewPost(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	expected := `{"name":"Ram"}`
+	expected := `{"name":"Ram"}` + "\n"
 	if string(data) != expected {
 		t.Errorf("Expected %s got '%v'", expected, string(data))
 	}
@@ -117,8 +120,49 @@ func TestViewDelete(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	expected := `{"name":"Cosmo"}`
+	expected := `{"name":"Cosmo"}` + "\n"
 	if string(data) != expected {
 		t.Errorf("Expected %s got '%v'", expected, string(data))
 	}
 }
+
+func TestViewTimeout(t *testing.T) {
+	c := Config{}
+	mockApp := NewTestApp(c)
+	ctxErr := make(chan error, 1)
+	mockApp.Route("/reports").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		<-r.Context().Done()
+		ctxErr <- r.Context().Err()
+	}).Methods("GET").Timeout(10 * time.Millisecond)
+	mockApp.Start()
+
+	req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	w := httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, req)
+	resp := w.Result()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if err := <-ctxErr; err != context.DeadlineExceeded {
+		t.Errorf("Expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestViewMaxBodyBytes(t *testing.T) {
+	c := Config{MaxBodyBytes: 4}
+	mockApp := NewTestApp(c)
+	var readErr error
+	mockApp.Route("/upload").View(func(w http.ResponseWriter, r *http.Request, d *Data) {
+		_, readErr = io.ReadAll(r.Body)
+	}).Methods("POST")
+	mockApp.Start()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("too large"))
+	w := httptest.NewRecorder()
+	mockApp.(*TestApp).Mux.ServeHTTP(w, req)
+
+	if readErr == nil {
+		t.Errorf("Expected an error reading a body larger than %d bytes", c.MaxBodyBytes)
+	}
+}
@@ -0,0 +1,459 @@
+package gomek
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, RFC 6455 section 5.2
+const (
+	WS_CONTINUATION = 0
+	WS_TEXT         = 1
+	WS_BINARY       = 2
+	WS_CLOSE        = 8
+	WS_PING         = 9
+	WS_PONG         = 10
+)
+
+// WebSocket close codes, RFC 6455 section 7.4.1
+const (
+	WS_CLOSE_NORMAL            = 1000
+	WS_CLOSE_GOING_AWAY        = 1001
+	WS_CLOSE_PROTOCOL_ERROR    = 1002
+	WS_CLOSE_UNSUPPORTED_DATA  = 1003
+	WS_CLOSE_NO_STATUS         = 1005
+	WS_CLOSE_ABNORMAL          = 1006
+	WS_CLOSE_INVALID_PAYLOAD   = 1007
+	WS_CLOSE_POLICY_VIOLATION  = 1008
+	WS_CLOSE_MESSAGE_TOO_BIG   = 1009
+	WS_CLOSE_INTERNAL_ERROR    = 1011
+	DEFAULT_WS_MAX_MESSAGE     = 1 << 20 // 1 MB
+	DEFAULT_WS_CLOSE_TIMEOUT   = 5 * time.Second
+	websocketGUID              = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlFramePayloadSize = 125
+)
+
+// CloseError is returned by `WebSocketConn.ReadMessage` once the connection is closed
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (c *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", c.Code, c.Reason)
+}
+
+// WebSocketHandler is called with the upgraded connection. The connection is
+// closed once the handler returns.
+type WebSocketHandler func(conn *WebSocketConn, r *http.Request)
+
+// WebSocketOptions configures a WebSocket route
+type WebSocketOptions struct {
+	// AllowedOrigins are the `Origin` hosts allowed to connect, e.g. "example.com".
+	// By default only same origin requests & clients that send no Origin are allowed.
+	AllowedOrigins []string
+	// MaxMessageSize is the largest message that will be read, larger messages
+	// close the connection with 1009. Defaults to `DEFAULT_WS_MAX_MESSAGE`.
+	MaxMessageSize int64
+	// PingInterval sends a ping this often. The connection is closed if nothing is
+	// received for two intervals. Zero disables pings.
+	PingInterval time.Duration
+}
+
+// WebSocketOption changes a single WebSocketOptions value
+type WebSocketOption func(o *WebSocketOptions)
+
+// WebSocketOrigins allows browsers on other origins to connect
+//
+//	app.Route("/ws").WebSocket(chat, gomek.WebSocketOrigins("app.example.com"))
+func WebSocketOrigins(origins ...string) WebSocketOption {
+	return func(o *WebSocketOptions) {
+		o.AllowedOrigins = origins
+	}
+}
+
+// WebSocketMaxMessageSize sets the largest message that will be read
+func WebSocketMaxMessageSize(n int64) WebSocketOption {
+	return func(o *WebSocketOptions) {
+		o.MaxMessageSize = n
+	}
+}
+
+// WebSocketPingInterval sends a ping every d & closes unresponsive connections
+func WebSocketPingInterval(d time.Duration) WebSocketOption {
+	return func(o *WebSocketOptions) {
+		o.PingInterval = d
+	}
+}
+
+// WebSocket upgrades requests to the current route to a WebSocket connection
+// & calls handler. Middleware, including `Authorize`, runs before the upgrade.
+// If no methods have been set the route accepts GET.
+//
+//	app.Route("/ws").WebSocket(func(conn *gomek.WebSocketConn, r *http.Request) {
+//		for {
+//			messageType, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(messageType, msg)
+//		}
+//	})
+func (a *App) WebSocket(handler WebSocketHandler, opts ...WebSocketOption) *App {
+	o := WebSocketOptions{MaxMessageSize: DEFAULT_WS_MAX_MESSAGE}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	a.currentView = func(w http.ResponseWriter, r *http.Request, d *Data) {
+		conn, status, err := upgradeWebSocket(w, r, o)
+		if err != nil {
+			if status != 0 {
+				if status == http.StatusUpgradeRequired {
+					w.Header().Set("Sec-WebSocket-Version", "13")
+				}
+				Problem(w, status, "", err.Error(), nil)
+			}
+			return
+		}
+		defer conn.Close(WS_CLOSE_NORMAL, "")
+		handler(conn, r)
+	}
+	if len(a.currentMethods) == 0 {
+		a.Methods("GET")
+	}
+	return a
+}
+
+func headerContainsToken(h http.Header, name string, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkOrigin allows clients without an Origin, the same origin & allowed origins
+func checkOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(u.Host, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// upgradeWebSocket performs the opening handshake, RFC 6455 section 4.2. A non
+// zero status is returned if the error should be sent to the client.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, o WebSocketOptions) (*WebSocketConn, int, error) {
+	if r.Method != http.MethodGet {
+		return nil, http.StatusMethodNotAllowed, errors.New("websocket upgrades must use GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, http.StatusBadRequest, errors.New("not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, http.StatusUpgradeRequired, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, http.StatusBadRequest, errors.New("invalid Sec-WebSocket-Key")
+	}
+	if !checkOrigin(r, o.AllowedOrigins) {
+		return nil, http.StatusForbidden, errors.New("origin not allowed")
+	}
+	netConn, brw, err := hijack(w)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	// Clear the deadlines set from the server's read & write timeouts
+	netConn.SetDeadline(time.Time{})
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, 0, err
+	}
+	conn := &WebSocketConn{
+		conn:           netConn,
+		reader:         brw.Reader,
+		maxMessageSize: o.MaxMessageSize,
+		pingInterval:   o.PingInterval,
+		done:           make(chan struct{}),
+	}
+	if conn.pingInterval > 0 {
+		conn.conn.SetReadDeadline(time.Now().Add(2 * conn.pingInterval))
+		go conn.ping()
+	}
+	return conn, 0, nil
+}
+
+// WebSocketConn is an upgraded WebSocket connection. Reads must happen from a
+// single goroutine, writes are safe from many goroutines.
+type WebSocketConn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	writeMu        sync.Mutex
+	maxMessageSize int64
+	pingInterval   time.Duration
+	closeOnce      sync.Once
+	closeSent      bool
+	done           chan struct{}
+}
+
+// ping keeps the connection alive until it is closed
+func (c *WebSocketConn) ping() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.writeFrame(WS_PING, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// RemoteAddr returns the client's network address
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+type frame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// readFrame reads a single client frame, RFC 6455 section 5.2. limit is the
+// largest payload that will be read.
+func (c *WebSocketConn) readFrame(limit int64) (frame, error) {
+	var f frame
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return f, err
+	}
+	if c.pingInterval > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(2 * c.pingInterval))
+	}
+	f.fin = header[0]&0x80 != 0
+	f.opcode = int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return f, c.fail(WS_CLOSE_PROTOCOL_ERROR, "reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return f, c.fail(WS_CLOSE_PROTOCOL_ERROR, "client frames must be masked")
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, b); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, b); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint64(b))
+		if length < 0 {
+			return f, c.fail(WS_CLOSE_PROTOCOL_ERROR, "invalid payload length")
+		}
+	}
+	isControl := f.opcode >= WS_CLOSE
+	if isControl && (!f.fin || length > maxControlFramePayloadSize) {
+		return f, c.fail(WS_CLOSE_PROTOCOL_ERROR, "invalid control frame")
+	}
+	if !isControl && length > limit {
+		return f, c.fail(WS_CLOSE_MESSAGE_TOO_BIG, "message too big")
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, mask); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// fail closes the connection with code & returns the matching CloseError
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// ReadMessage reads the next text or binary message, answering pings & joining
+// fragmented messages. A `*CloseError` is returned once the client closes the
+// connection.
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	var (
+		messageType int
+		message     []byte
+	)
+	for {
+		f, err := c.readFrame(c.maxMessageSize - int64(len(message)))
+		if err != nil {
+			var (
+				closeErr *CloseError
+				netErr   net.Error
+			)
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, nil, c.fail(WS_CLOSE_GOING_AWAY, "ping timeout")
+			}
+			if !errors.As(err, &closeErr) {
+				c.conn.Close()
+			}
+			return 0, nil, err
+		}
+		switch f.opcode {
+		case WS_PING:
+			if err := c.writeFrame(WS_PONG, f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WS_PONG:
+			continue
+		case WS_CLOSE:
+			code, reason := WS_CLOSE_NO_STATUS, ""
+			if len(f.payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(f.payload))
+				reason = string(f.payload[2:])
+			}
+			// Echo the close frame then drop the connection, section 5.5.1
+			echo := code
+			if echo == WS_CLOSE_NO_STATUS {
+				echo = WS_CLOSE_NORMAL
+			}
+			c.Close(echo, "")
+			return 0, nil, &CloseError{Code: code, Reason: reason}
+		case WS_TEXT, WS_BINARY:
+			if messageType != 0 {
+				return 0, nil, c.fail(WS_CLOSE_PROTOCOL_ERROR, "expected a continuation frame")
+			}
+			messageType = f.opcode
+		case WS_CONTINUATION:
+			if messageType == 0 {
+				return 0, nil, c.fail(WS_CLOSE_PROTOCOL_ERROR, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(WS_CLOSE_PROTOCOL_ERROR, "unknown opcode")
+		}
+		message = append(message, f.payload...)
+		if f.fin {
+			if messageType == WS_TEXT && !utf8.Valid(message) {
+				return 0, nil, c.fail(WS_CLOSE_INVALID_PAYLOAD, "invalid UTF-8")
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return &CloseError{Code: WS_CLOSE_NORMAL, Reason: "connection closed"}
+	}
+	header := []byte{0x80 | byte(opcode)}
+	length := len(payload)
+	switch {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if opcode == WS_CLOSE {
+		c.closeSent = true
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteMessage sends a `WS_TEXT` or `WS_BINARY` message
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WS_TEXT && messageType != WS_BINARY {
+		return fmt.Errorf("gomek: invalid websocket message type %d", messageType)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// WriteText sends a text message
+func (c *WebSocketConn) WriteText(text string) error {
+	return c.writeFrame(WS_TEXT, []byte(text))
+}
+
+// Ping sends a ping, the client's pong is handled by `ReadMessage`
+func (c *WebSocketConn) Ping(data []byte) error {
+	if len(data) > maxControlFramePayloadSize {
+		return errors.New("gomek: ping payload too large")
+	}
+	return c.writeFrame(WS_PING, data)
+}
+
+// Close sends a close frame with code & reason, then closes the connection.
+// Calling Close more than once has no effect.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > maxControlFramePayloadSize {
+			payload = payload[:maxControlFramePayloadSize]
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(DEFAULT_WS_CLOSE_TIMEOUT))
+		err = c.writeFrame(WS_CLOSE, payload)
+		c.conn.Close()
+	})
+	return err
+}
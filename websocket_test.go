@@ -0,0 +1,281 @@
+package gomek
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// dialWebSocket performs the opening handshake & returns the connection & status line
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	req, _ := http.NewRequest("GET", server.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", testWebSocketKey)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return conn, reader, res
+}
+
+// writeClientFrame writes a masked client frame
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, opcode int, payload []byte) {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	header := []byte{first}
+	switch {
+	case len(payload) <= 125:
+		header = append(header, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+	if _, err := conn.Write(append(append(header, mask...), masked...)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+}
+
+// readServerFrame reads a single unmasked server frame
+func readServerFrame(t *testing.T, reader *bufio.Reader) (int, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		b := make([]byte, 2)
+		io.ReadFull(reader, b)
+		length = int(binary.BigEndian.Uint16(b))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return int(header[0] & 0x0f), payload
+}
+
+func newEchoApp(closed chan error, opts ...WebSocketOption) *App {
+	app := New(Config{})
+	app.Use(Logging)
+	app.Route("/ws").WebSocket(func(conn *WebSocketConn, r *http.Request) {
+		for {
+			messageType, msg, err := conn.ReadMessage()
+			if err != nil {
+				if closed != nil {
+					closed <- err
+				}
+				return
+			}
+			conn.WriteMessage(messageType, msg)
+		}
+	}, opts...)
+	return app
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	closed := make(chan error, 1)
+	server := httptest.NewServer(newEchoApp(closed).setup().Handler)
+	defer server.Close()
+	conn, reader, res := dialWebSocket(t, server, "/ws", nil)
+	defer conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101 got %d", res.StatusCode)
+	}
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected the RFC 6455 accept key got %q", accept)
+	}
+	writeClientFrame(t, conn, true, WS_TEXT, []byte("hello"))
+	if op, payload := readServerFrame(t, reader); op != WS_TEXT || string(payload) != "hello" {
+		t.Errorf("Expected text hello got %d %q", op, payload)
+	}
+	// Fragmented message with a ping in between
+	writeClientFrame(t, conn, false, WS_BINARY, []byte("ab"))
+	writeClientFrame(t, conn, true, WS_PING, []byte("p"))
+	writeClientFrame(t, conn, true, WS_CONTINUATION, []byte(strings.Repeat("c", 200)))
+	if op, payload := readServerFrame(t, reader); op != WS_PONG || string(payload) != "p" {
+		t.Errorf("Expected pong p got %d %q", op, payload)
+	}
+	if op, payload := readServerFrame(t, reader); op != WS_BINARY || len(payload) != 202 {
+		t.Errorf("Expected 202 byte binary message got %d %d", op, len(payload))
+	}
+	writeClientFrame(t, conn, true, WS_CLOSE, []byte{0x03, 0xe8, 'b', 'y', 'e'})
+	op, payload := readServerFrame(t, reader)
+	if op != WS_CLOSE || binary.BigEndian.Uint16(payload) != WS_CLOSE_NORMAL {
+		t.Errorf("Expected a 1000 close frame got %d %v", op, payload)
+	}
+	var closeErr *CloseError
+	if err := <-closed; !errors.As(err, &closeErr) || closeErr.Code != WS_CLOSE_NORMAL || closeErr.Reason != "bye" {
+		t.Errorf("Expected CloseError 1000 bye got %v", err)
+	}
+}
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	server := httptest.NewServer(newEchoApp(nil, WebSocketMaxMessageSize(10)).setup().Handler)
+	defer server.Close()
+	conn, reader, _ := dialWebSocket(t, server, "/ws", nil)
+	defer conn.Close()
+	writeClientFrame(t, conn, true, WS_TEXT, []byte(strings.Repeat("a", 11)))
+	op, payload := readServerFrame(t, reader)
+	if op != WS_CLOSE || binary.BigEndian.Uint16(payload) != WS_CLOSE_MESSAGE_TOO_BIG {
+		t.Errorf("Expected a 1009 close frame got %d %v", op, payload)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	server := httptest.NewServer(newEchoApp(nil).setup().Handler)
+	defer server.Close()
+	tests := []struct {
+		name  string
+		frame []byte
+		code  uint16
+	}{
+		{"unmasked", []byte{0x81, 0x01, 'a'}, WS_CLOSE_PROTOCOL_ERROR},
+		{"reserved bits", []byte{0xc1, 0x81, 0, 0, 0, 0, 'a'}, WS_CLOSE_PROTOCOL_ERROR},
+		{"invalid utf-8", []byte{0x81, 0x81, 0, 0, 0, 0, 0xff}, WS_CLOSE_INVALID_PAYLOAD},
+		{"continuation first", []byte{0x80, 0x81, 0, 0, 0, 0, 'a'}, WS_CLOSE_PROTOCOL_ERROR},
+	}
+	for _, tt := range tests {
+		conn, reader, _ := dialWebSocket(t, server, "/ws", nil)
+		conn.Write(tt.frame)
+		op, payload := readServerFrame(t, reader)
+		if op != WS_CLOSE || binary.BigEndian.Uint16(payload) != tt.code {
+			t.Errorf("%s: expected a %d close frame got %d %v", tt.name, tt.code, op, payload)
+		}
+		conn.Close()
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	app := newEchoApp(nil, WebSocketOrigins("trusted.example.com"))
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"cross origin", http.Header{"Origin": {"https://evil.example.com"}}, http.StatusForbidden},
+		{"bad version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"bad key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		conn, _, res := dialWebSocket(t, server, "/ws", tt.header)
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: expected %d got %d", tt.name, tt.status, res.StatusCode)
+		}
+		conn.Close()
+	}
+	conn, _, res := dialWebSocket(t, server, "/ws", http.Header{"Origin": {"https://trusted.example.com"}})
+	defer conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected an allowed origin to upgrade got %d", res.StatusCode)
+	}
+	// Plain requests are not upgrades
+	plain, err := http.Get(server.URL + "/ws")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 got %d", plain.StatusCode)
+	}
+}
+
+func TestWebSocketAuthorize(t *testing.T) {
+	upgraded := false
+	app := New(Config{})
+	app.Use(Authorize([][]string{}, func(r *http.Request) (bool, context.Context) {
+		return r.Header.Get("Authorization") == "Bearer token", nil
+	}))
+	app.Route("/ws").WebSocket(func(conn *WebSocketConn, r *http.Request) {
+		upgraded = true
+	})
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+	conn, _, res := dialWebSocket(t, server, "/ws", nil)
+	conn.Close()
+	if res.StatusCode != http.StatusUnauthorized || upgraded {
+		t.Errorf("Expected 401 before upgrading got %d", res.StatusCode)
+	}
+	conn, _, res = dialWebSocket(t, server, "/ws", http.Header{"Authorization": {"Bearer token"}})
+	defer conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected 101 got %d", res.StatusCode)
+	}
+}
+
+func TestWebSocketPingInterval(t *testing.T) {
+	server := httptest.NewServer(newEchoApp(nil, WebSocketPingInterval(20*time.Millisecond)).setup().Handler)
+	defer server.Close()
+	conn, reader, _ := dialWebSocket(t, server, "/ws", nil)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if op, _ := readServerFrame(t, reader); op != WS_PING {
+		t.Errorf("Expected a ping got %d", op)
+	}
+	// Without replying the server drops the connection
+	for {
+		op, _ := readServerFrame(t, reader)
+		if op == WS_CLOSE {
+			break
+		}
+	}
+}
+
+func TestWebSocketRouteTimeout(t *testing.T) {
+	app := New(Config{})
+	app.Route("/ws").WebSocket(func(conn *WebSocketConn, r *http.Request) {
+		messageType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(messageType, msg)
+	}).Timeout(20 * time.Millisecond)
+	server := httptest.NewServer(app.setup().Handler)
+	defer server.Close()
+
+	conn, reader, res := dialWebSocket(t, server, "/ws", nil)
+	defer conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected %d got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+	// The timeout only applies until the upgrade
+	time.Sleep(50 * time.Millisecond)
+	writeClientFrame(t, conn, true, WS_TEXT, []byte("hello"))
+	if opcode, payload := readServerFrame(t, reader); opcode != WS_TEXT || string(payload) != "hello" {
+		t.Errorf("Expected hello got %d %s", opcode, payload)
+	}
+}